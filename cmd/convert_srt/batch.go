@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"yt_enhancer/pkg/config"
+	"yt_enhancer/pkg/gemini"
+)
+
+// captionExtensions are the file extensions picked up in batch mode
+var captionExtensions = map[string]bool{".srv3": true, ".json3": true, ".vtt": true}
+
+// fileResult is the outcome of converting one file in batch mode
+type fileResult struct {
+	input   string
+	output  string
+	skipped bool
+	err     error
+}
+
+// findCaptionFiles walks dir and returns the caption files in it, sorted by path
+func findCaptionFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && captionExtensions[strings.ToLower(filepath.Ext(path))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// processDir converts every caption file under dir to a sibling subtitle file, or
+// the path OUTPUT_PATTERN gives, with bounded concurrency, continuing past failures
+// and logging a summary at the end. Files whose output already exists are skipped
+// unless force is set.
+func processDir(ctx context.Context, cfg *config.Config, client *gemini.Client, dir string,
+	jobs int, force bool, opts convertOptions) error {
+
+	files, err := findCaptionFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no caption files found in %s", dir)
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]fileResult, len(files))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+
+	for i, input := range files {
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = convertFile(ctx, cfg, client, input, force, opts)
+		}(i, input)
+	}
+	wg.Wait()
+
+	// Report per-file results
+	converted, skipped, failed := 0, 0, 0
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			failed++
+			slog.Error("file failed", "input", r.input, "error", r.err)
+		case r.skipped:
+			skipped++
+			slog.Info("file skipped, output exists", "input", r.input, "output", r.output)
+		default:
+			converted++
+			slog.Info("file converted", "input", r.input, "output", r.output)
+		}
+	}
+	slog.Info("batch complete", "converted", converted, "skipped", skipped, "failed", failed)
+	if opts.usesAPI() {
+		printUsageReport(cfg, client)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return nil
+}
+
+// convertFile converts a single file in batch mode
+func convertFile(ctx context.Context, cfg *config.Config, client *gemini.Client, input string,
+	force bool, opts convertOptions) fileResult {
+
+	output := outputPathFor(cfg, input)
+	result := fileResult{input: input, output: output}
+
+	if output == input {
+		result.err = fmt.Errorf("output would overwrite the input; choose another -ext or -o-pattern")
+		return result
+	}
+	if !force {
+		if _, err := os.Stat(output); err == nil {
+			result.skipped = true
+			return result
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			result.err = err
+			return result
+		}
+	}
+
+	slog.Info("converting", "input", input, "output", output)
+	result.err = processSubtitles(ctx, cfg, client, input, output, opts, &runReport{})
+	return result
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"yt_enhancer/pkg/subtitle"
+)
+
+// blockReportPath returns the CSV file -report writes next to outputPath, e.g.
+// video.report.csv for video.srt
+func blockReportPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".report.csv"
+}
+
+// printBlockReports prints the diagnostics of each block as a table
+func printBlockReports(w io.Writer, reports []subtitle.BlockReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "block\tstart_ms\tend_ms\tduration_ms\tchars\tcps\twords\t")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%.1f\t%s\t\n", r.Block+1,
+			r.StartMs, r.EndMs, r.EndMs-r.StartMs, r.Chars, r.CPS, wordRange(r))
+	}
+	return tw.Flush()
+}
+
+// writeBlockReports writes the diagnostics of each block as CSV to path
+func writeBlockReports(path string, reports []subtitle.BlockReport) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating block report: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"block", "start_ms", "end_ms", "duration_ms", "chars", "cps", "first_word", "last_word", "text"})
+	for _, r := range reports {
+		w.Write([]string{
+			strconv.Itoa(r.Block + 1),
+			strconv.Itoa(r.StartMs),
+			strconv.Itoa(r.EndMs),
+			strconv.Itoa(r.EndMs - r.StartMs),
+			strconv.Itoa(r.Chars),
+			strconv.FormatFloat(r.CPS, 'f', 1, 64),
+			strconv.Itoa(r.FirstWord),
+			strconv.Itoa(r.LastWord),
+			r.Text,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing block report: %w", err)
+	}
+	return file.Close()
+}
+
+// wordRange formats the source words of a block as first-last, or - if it has none
+func wordRange(r subtitle.BlockReport) string {
+	if r.FirstWord < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d-%d", r.FirstWord, r.LastWord)
+}
@@ -1,54 +1,186 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
+	"yt_enhancer"
 	"yt_enhancer/pkg/config"
 	"yt_enhancer/pkg/gemini"
+	"yt_enhancer/pkg/logging"
+	"yt_enhancer/pkg/models"
 	"yt_enhancer/pkg/parser"
 	"yt_enhancer/pkg/subtitle"
 )
 
+// stdout is the process's real standard output. It stays reserved for the JSON
+// report or piped subtitles after os.Stdout is redirected to stderr.
+var stdout = os.Stdout
+
+// Exit codes, so scripts can tell failure classes apart
+const (
+	exitFailure = 1 // Any other failure, such as an unwritable output
+	exitUsage   = 2 // Invalid flags or configuration
+	exitInput   = 3 // The input captions couldn't be read or parsed
+	exitAPI     = 4 // The API request failed, e.g. quota exceeded or an unusable response
+	exitCheck   = 5 // A -strict or -stability-check quality check failed
+)
+
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitError attaches an exit code to an error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode makes the program exit with code if err ends the run
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
 	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code for an error returned by run
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
 }
 
 func run() error {
 	// Parse command line flags
 	envFile := flag.String("env", ".env", "Environment file path")
-	outputFile := flag.String("o", "", "Output file path (default: same as input with .srt extension)")
+	configFile := flag.String("config", "", "YAML or JSON config file; environment variables take precedence")
+	outputFile := flag.String("o", "", "Output file path, or - for stdout (default: same as input with the output extension, stdout for - or URL input)")
+	format := flag.String("format", "", "Output format: srt, vtt, json, ass, json3 or txt (default: from -o extension, else srt)")
+	formats := flag.String("formats", "", "Comma-separated output formats to write side by side, e.g. srt,json,vtt")
+	ext := flag.String("ext", "", "Output file extension (default: matches -format)")
+	outputPattern := flag.String("o-pattern", "", "Output path pattern with {dir}, {name}, {ext} and {lang} tokens, e.g. {dir}/{name}.{lang}.srt")
 	debugMode := flag.Bool("debug", false, "Enable debug mode")
 	debugDir := flag.String("debug-dir", "debug", "Directory to store debug files")
+	deterministic := flag.Bool("deterministic", false, "Use temperature 0 and a fixed seed so runs are reproducible")
+	modelTimings := flag.Bool("model-timings", false, "Time blocks by the st_ms and lw_ms the model returns instead of the source words")
+	noCache := flag.Bool("no-cache", false, "Always call the API, ignoring the GEMINI_CACHE_DIR response cache")
+	concurrency := flag.Int("concurrency", 0, "Number of batches sent to the API in parallel (default 1)")
+	silenceGap := flag.Int("silence-gap", 0, "Insert placeholder cues in gaps longer than this many ms (0 disables)")
+	silenceMarker := flag.String("silence-marker", "", "Text of the placeholder cues inserted for silences")
+	lastWordPad := flag.Int("last-word-pad", -1, "Display time in ms added after the last word of a subtitle (default 1500)")
+	minBlockDuration := flag.Int("min-block-duration", -1, "Minimum display time in ms of a refined subtitle (default 1000)")
+	lastWordCharMs := flag.Float64("last-word-char-ms", -1, "Extra display time in ms per character of the last word (default 0)")
+	maxWPS := flag.Float64("max-wps", -1, "Flag blocks faster than this many words/second as mis-timed (default 10, 0 disables)")
+	maxCPS := flag.Float64("max-cps", -1, "Extend blocks read faster than this many characters/second (default 17, 0 disables)")
+	maxLineLength := flag.Int("max-line-length", -1, "Wrap subtitle text at this many characters per line (default 0, disabled)")
+	strict := flag.Bool("strict", false, "Fail instead of warning when quality checks flag blocks")
+	verifyWords := flag.Bool("verify-words", false, "Flag blocks whose text has words that aren't in the source captions")
+	langHint := flag.String("lang-hint", "", "Language line of the prompt, e.g. \"Japanese, English (few words)\" (default Thai, English (few words))")
+	lowConfidence := flag.Float64("low-confidence", -1, "Mark source words recognized with less confidence than this, from 0 to 1, and list their blocks (default 0, disabled)")
+	maxBlockDuration := flag.Int("max-block-duration", 0, "Split blocks shown longer than this many ms (0 disables)")
+	mergeDuplicates := flag.Int("merge-duplicates-gap", 0, "Merge consecutive identical blocks separated by less than this many ms (0 disables)")
+	translate := flag.String("translate", "", "Also write a translation of the subtitles into this language, e.g. en")
+	translateOnly := flag.Bool("translate-only", false, "Write only the translation, not the refined original")
+	bilingual := flag.Bool("bilingual", false, "Write the translation as two-line cues with the original text on the first line")
+	normalizePunct := flag.Bool("normalize-punctuation", false, "Normalize sentence-ending punctuation across cues")
+	keepFormatting := flag.Bool("keep-formatting", false, "Keep bold, italic and underline from srv3 captions as <b>, <i> and <u> tags")
+	shift := flag.Int("shift", 0, "Move all subtitles by this many ms, earlier if negative, e.g. -shift=-400")
+	scale := flag.String("scale", "", "Stretch all timings by this factor or ratio, e.g. 23.976/25, to fix frame rate drift")
+	scaleAnchor := flag.String("scale-anchor", "", "Time that stays fixed with -scale, as HH:MM:SS or seconds (default 0)")
+	since := flag.String("since", "", "Only keep subtitles after this time, as HH:MM:SS or seconds")
+	until := flag.String("until", "", "Only keep subtitles before this time, as HH:MM:SS or seconds")
+	rebase := flag.Bool("rebase", false, "Move the kept subtitles so -since becomes zero")
+	rtl := flag.Bool("rtl", false, "Wrap right-to-left lines, such as Arabic or Hebrew, in directional embedding marks")
+	redactPII := flag.Bool("redact", false, "Redact emails and phone numbers before sending text to the API")
+	redactPatterns := flag.String("redact-patterns", "", "File of redaction regexes, one per line (implies -redact)")
+	stabilityCheck := flag.Bool("stability-check", false, "Re-process the output and fail if the subtitles change")
+	resume := flag.Bool("resume", false, "Continue an interrupted run from the checkpoint saved next to the output")
+	savePartial := flag.Bool("save-partial", false, "When a run fails, write the subtitles of the batches that were done to name.partial.srt (name.incomplete.json for JSON)")
+	raw := flag.Bool("raw", false, "Group the source words into blocks as is, without calling the API")
+	offline := flag.Bool("offline", false, "Group the source words into sentences at pauses and punctuation, without calling the API")
+	maxWordsPerBlock := flag.Int("max-words-per-block", -1, "Maximum words per block in -raw mode (default 12, 0 disables)")
+	minBlockMs := flag.Int("min-block-ms", -1, "Minimum display time of a block in ms in -raw and -offline mode (default 1000)")
+	pauseMs := flag.Int("pause-ms", -1, "Start a new block after a pause this many ms long in -raw and -offline mode (default 1000, 0 disables)")
+	batch := flag.Bool("batch", false, "Treat the input as a directory and convert every caption file in it")
+	jobs := flag.Int("jobs", 1, "Number of files converted at the same time in -batch mode")
+	force := flag.Bool("force", false, "Overwrite existing outputs in -batch mode instead of skipping them")
+	estimate := flag.Bool("estimate", false, "Print the estimated batch count and token usage and exit without calling the API")
+	verbose := flag.Bool("verbose", false, "Print the duration, characters, CPS and source words of each block after converting")
+	flag.BoolVar(verbose, "v", false, "Alias for -verbose")
+	blockReport := flag.Bool("report", false, "Write the -verbose block diagnostics to a .report.csv next to the output")
+	reportJSON := flag.Bool("report-json", false, "Print a JSON summary of the run to stdout, with input, output, wordCount, blockCount, batches and durationMs among its keys (other output goes to stderr)")
+	flag.BoolVar(reportJSON, "json", false, "Alias for -report-json")
 	flag.Parse()
 
 	// Validate command line arguments
 	if len(flag.Args()) < 1 {
-		return fmt.Errorf("usage: convert_srt [-env=.env] [-o=output.srt] [-debug] [-debug-dir=debug] input.srv3")
+		return withExitCode(exitUsage, fmt.Errorf("usage: convert_srt [options] input-captions | - | URL | -batch directory (run with -h to list options)"))
+	}
+	if *batch && (*outputFile != "" || *reportJSON) {
+		return withExitCode(exitUsage, fmt.Errorf("-o and -report-json can't be used with -batch"))
 	}
 
+	// Captions read from stdin or a URL have no file name to derive the output
+	// from, so they are written to stdout unless -o is given
 	inputPath := flag.Arg(0)
-
-	// Validate file extension
-	if !strings.HasSuffix(strings.ToLower(inputPath), ".srv3") {
-		return fmt.Errorf("input file must have .srv3 extension")
+	if isStreamInput(inputPath) {
+		if *batch {
+			return withExitCode(exitUsage, fmt.Errorf("-batch needs a directory, not stdin or a URL"))
+		}
+		if *outputFile == "" && *outputPattern != "" {
+			return withExitCode(exitUsage, fmt.Errorf("-o-pattern needs a file input; use -o with stdin or a URL"))
+		}
+		if *outputFile == "" && *reportJSON {
+			return withExitCode(exitUsage, fmt.Errorf("-report-json needs -o when reading stdin or a URL"))
+		}
+		if *outputFile == "" {
+			*outputFile = "-"
+		}
 	}
 
-	// Determine output path
-	outputPath := *outputFile
-	if outputPath == "" {
-		outputPath = strings.TrimSuffix(inputPath, ".srv3") + ".srt"
+	// Keep stdout clean for the JSON report or piped subtitles by sending everything
+	// else to stderr
+	if *reportJSON && *outputFile == "-" {
+		return withExitCode(exitUsage, fmt.Errorf("-report-json and -o - can't both write to stdout"))
+	}
+	if *reportJSON || *outputFile == "-" {
+		os.Stdout = os.Stderr
 	}
 
 	// Load configuration
-	cfg, err := loadConfig(*envFile)
+	cfg, err := loadConfig(*envFile, *configFile)
 	if err != nil {
-		return err
+		return withExitCode(exitUsage, err)
+	}
+
+	// Raw and offline conversions never call the API, so they run without a key
+	if *raw && *offline {
+		return withExitCode(exitUsage, fmt.Errorf("-raw and -offline can't be used together"))
+	}
+	if !*raw && !*offline {
+		if err := cfg.CheckAPIKey(); err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("error loading configuration: %w", err))
+		}
 	}
 
 	// Override config with command line flags if provided
@@ -58,65 +190,491 @@ func run() error {
 	if *debugDir != "" {
 		cfg.DebugDir = *debugDir
 	}
+	if *noCache {
+		cfg.GeminiCacheDir = ""
+	}
+	if *deterministic {
+		cfg.Deterministic = true
+	}
+	if *modelTimings {
+		cfg.ModelTimings = true
+	}
+	if *savePartial {
+		cfg.SavePartial = true
+	}
+	if *concurrency > 0 {
+		cfg.GeminiConcurrency = *concurrency
+	}
+	if *silenceGap > 0 {
+		cfg.SilenceGapMs = *silenceGap
+	}
+	if *silenceMarker != "" {
+		cfg.SilenceMarker = *silenceMarker
+	}
+	if *lastWordPad >= 0 {
+		cfg.LastWordPadMs = *lastWordPad
+	}
+	if *minBlockDuration >= 0 {
+		cfg.MinBlockDurationMs = *minBlockDuration
+	}
+	if *lastWordCharMs >= 0 {
+		cfg.LastWordCharMs = *lastWordCharMs
+	}
+	if *maxWPS >= 0 {
+		cfg.MaxWordsPerSecond = *maxWPS
+	}
+	if *maxCPS >= 0 {
+		cfg.MaxCPS = *maxCPS
+	}
+	if *maxLineLength >= 0 {
+		cfg.MaxLineLength = *maxLineLength
+	}
+	if *strict {
+		cfg.Strict = true
+	}
+	if *verifyWords {
+		cfg.VerifyWords = true
+	}
+	if *langHint != "" {
+		cfg.LanguageHint = *langHint
+	}
+	if *lowConfidence >= 0 {
+		cfg.LowConfidence = *lowConfidence
+	}
+	if *maxWordsPerBlock >= 0 {
+		cfg.RawMaxWords = *maxWordsPerBlock
+	}
+	if *minBlockMs >= 0 {
+		cfg.RawMinBlockMs = *minBlockMs
+	}
+	if *pauseMs >= 0 {
+		cfg.RawPauseMs = *pauseMs
+	}
+	if *mergeDuplicates > 0 {
+		cfg.MergeDuplicatesGapMs = *mergeDuplicates
+	}
+	if *maxBlockDuration > 0 {
+		cfg.MaxBlockDurationMs = *maxBlockDuration
+	}
+	if *normalizePunct {
+		cfg.NormalizePunctuation = true
+	}
+	if *keepFormatting {
+		cfg.KeepFormatting = true
+	}
+	if *rtl {
+		cfg.RTLMarkers = true
+	}
+	if *shift != 0 {
+		cfg.ShiftMs = *shift
+	}
+	if *scale != "" {
+		if cfg.ScaleFactor, err = config.ParseScale(*scale); err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("-scale: %w", err))
+		}
+	}
+	if *scaleAnchor != "" {
+		if cfg.ScaleAnchorMs, err = config.ParseTimestamp(*scaleAnchor); err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("-scale-anchor: %w", err))
+		}
+	}
+	if *since != "" {
+		if cfg.ClipSinceMs, err = config.ParseTimestamp(*since); err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("-since: %w", err))
+		}
+	}
+	if *until != "" {
+		if cfg.ClipUntilMs, err = config.ParseTimestamp(*until); err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("-until: %w", err))
+		}
+	}
+	if *rebase {
+		cfg.ClipRebase = true
+	}
+	if *redactPII {
+		cfg.RedactPII = true
+	}
+	if *redactPatterns != "" {
+		cfg.RedactPII = true
+		cfg.RedactPatternsFile = *redactPatterns
+	}
+	if *formats != "" {
+		if *format != "" || *ext != "" {
+			return withExitCode(exitUsage, fmt.Errorf("-formats can't be used with -format or -ext"))
+		}
+		cfg.OutputFormats = config.ParseLanguages(*formats)
+	}
+	if *format != "" {
+		cfg.OutputFormat = *format
+	} else if len(cfg.OutputFormats) > 0 {
+		cfg.OutputFormat = cfg.OutputFormats[0]
+	} else if f := subtitle.FormatFromPath(*outputFile); f != "" {
+		cfg.OutputFormat = f
+	}
+	if *ext != "" {
+		cfg.OutputExt = *ext
+	}
+	if *outputPattern != "" {
+		cfg.OutputPattern = *outputPattern
+	}
+	if err := validateOutputPattern(cfg.OutputPattern); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if *translate != "" {
+		cfg.TranslateTo = *translate
+	}
+	if *translateOnly {
+		cfg.TranslateOnly = true
+	}
+	if *bilingual {
+		cfg.Bilingual = true
+	}
+	if cfg.TranslateOnly && cfg.TranslateTo == "" {
+		return withExitCode(exitUsage, fmt.Errorf("-translate-only requires -translate"))
+	}
+	if cfg.Bilingual && cfg.TranslateTo == "" {
+		return withExitCode(exitUsage, fmt.Errorf("-bilingual requires -translate"))
+	}
+	if (*raw || *offline) && (cfg.TranslateTo != "" || *stabilityCheck || *resume || *estimate) {
+		return withExitCode(exitUsage, fmt.Errorf("-raw and -offline can't be used with -translate, -stability-check, -resume or -estimate"))
+	}
+	if *outputFile == "-" && *resume {
+		return withExitCode(exitUsage, fmt.Errorf("-resume needs an output file, not stdout"))
+	}
+	if *outputFile == "-" && *savePartial {
+		return withExitCode(exitUsage, fmt.Errorf("-save-partial needs an output file, not stdout"))
+	}
+	if *outputFile == "-" && *blockReport {
+		return withExitCode(exitUsage, fmt.Errorf("-report needs an output file, not stdout"))
+	}
+	if *outputFile == "-" && cfg.TranslateTo != "" && !cfg.TranslateOnly {
+		return withExitCode(exitUsage, fmt.Errorf("-o - can only write one track; add -translate-only to pipe the translation"))
+	}
+
+	if len(cfg.OutputFormats) > 0 && *outputFile == "-" {
+		return withExitCode(exitUsage, fmt.Errorf("-formats writes several files and can't be used with -o -"))
+	}
+	if err := checkFormats(cfg.OutputFormats); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+
+	// Log to stdout (stderr with -report-json) at the configured level
+	if err := logging.Setup(os.Stdout, cfg.EffectiveLogLevel(), cfg.LogFormat); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+
+	// Determine output path; -o overrides the pattern. With -formats, its
+	// extension is replaced by each format's.
+	outputPath := *outputFile
+	if outputPath == "" {
+		outputPath = outputPathFor(cfg, inputPath)
+	} else if len(cfg.OutputFormats) > 0 {
+		outputPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "." + cfg.OutputFormat
+	}
 
-	fmt.Printf("Converting %s to %s\n", inputPath, outputPath)
+	// Only forecast API usage if requested
+	if *estimate && !*batch {
+		return printEstimate(cfg, inputPath)
+	}
+	if *estimate {
+		files, err := findCaptionFiles(inputPath)
+		if err != nil {
+			return withExitCode(exitInput, err)
+		}
+		for _, file := range files {
+			if err := printEstimate(cfg, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Cancel in-flight work on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Create the Gemini client, shared by all files in batch mode so that they
+	// respect the same rate limit
+	client, err := yt_enhancer.NewClient(cfg)
+	if err != nil {
+		return withExitCode(exitUsage, fmt.Errorf("error creating client: %w", err))
+	}
+
+	opts := convertOptions{
+		stabilityCheck: *stabilityCheck,
+		resume:         *resume,
+		raw:            *raw,
+		offline:        *offline,
+		verbose:        *verbose,
+		blockReport:    *blockReport,
+	}
+	if *batch {
+		return processDir(ctx, cfg, client, inputPath, *jobs, *force, opts)
+	}
+
+	slog.Info("converting", "input", inputPath, "output", outputPath)
 
 	// Process the subtitles
-	if err := processSubtitles(cfg, inputPath, outputPath); err != nil {
+	report := &runReport{Input: inputPath, Output: outputPath, Format: cfg.OutputFormat}
+	start := time.Now()
+
+	err = processSubtitles(ctx, cfg, client, inputPath, outputPath, opts, report)
+	usage := client.Usage()
+	report.APICalls = usage.APICalls
+	report.PromptTokens = usage.PromptTokens
+	report.OutputTokens = usage.OutputTokens
+	report.Retries = usage.Retries
+	report.Batches = usage.Batches
+	report.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	if *reportJSON {
+		if encErr := writeReport(stdout, report); encErr != nil {
+			slog.Warn("failed to write JSON report", "error", encErr)
+		}
+	}
+
+	if err != nil {
 		return fmt.Errorf("error processing subtitles: %w", err)
 	}
 
-	fmt.Printf("Successfully converted to %s\n", outputPath)
+	slog.Info("converted", "output", outputPath)
+	if opts.usesAPI() {
+		printUsageReport(cfg, client)
+	}
 	return nil
 }
 
-// loadConfig loads the application configuration
-func loadConfig(envFile string) (*config.Config, error) {
+// runReport is the machine-readable summary of a conversion printed by -report-json
+type runReport struct {
+	Input             string   `json:"input"`
+	Output            string   `json:"output"`
+	Outputs           []string `json:"outputs"`
+	Format            string   `json:"format"`
+	WordCount         int      `json:"wordCount"`
+	BlockCount        int      `json:"blockCount"`
+	Batches           int      `json:"batches"`
+	PreservationScore float64  `json:"preservationScore"`
+	APICalls          int      `json:"apiCalls"`
+	PromptTokens      int      `json:"promptTokens"`
+	OutputTokens      int      `json:"outputTokens"`
+	Retries           int      `json:"retries"`
+	DurationMs        int64    `json:"durationMs"`
+	Warnings          []string `json:"warnings"`
+	Error             string   `json:"error,omitempty"`
+}
+
+// checkFormats returns an error if any of formats isn't a supported output format
+func checkFormats(formats []string) error {
+	for _, format := range formats {
+		if !slices.Contains(subtitle.Formats, strings.ToLower(format)) {
+			return fmt.Errorf("unsupported output format %q in -formats (supported: %s)",
+				format, strings.Join(subtitle.Formats, ", "))
+		}
+	}
+	return nil
+}
+
+// writeReport writes the run report as a single JSON document
+func writeReport(w io.Writer, report *runReport) error {
+	if report.Outputs == nil {
+		report.Outputs = []string{}
+	}
+	if report.Warnings == nil {
+		report.Warnings = []string{}
+	}
+	return json.NewEncoder(w).Encode(report)
+}
+
+// loadConfig loads the application configuration from the environment, the .env
+// file and, if given, a config file, in that order of precedence
+func loadConfig(envFile, configFile string) (*config.Config, error) {
 	// Load environment variables from .env file (optional)
 	if err := config.LoadEnvFile(envFile); err != nil {
-		fmt.Printf("Warning: Error loading .env file: %v\n", err)
+		slog.Warn("failed to load .env file", "path", envFile, "error", err)
 	}
 
 	// Load configuration
-	cfg, err := config.Load()
+	var cfg *config.Config
+	var err error
+	if configFile != "" {
+		cfg, err = config.LoadFile(configFile)
+	} else {
+		cfg, err = config.Load()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error loading configuration: %w", err)
 	}
 	return cfg, nil
 }
 
-// processSubtitles handles the subtitle processing pipeline
-func processSubtitles(cfg *config.Config, inputPath, outputPath string) error {
-	// Parse the XML file
-	timedText, err := parser.ParseXMLFile(inputPath)
+// convertOptions are the per-file conversion settings given on the command line
+type convertOptions struct {
+	stabilityCheck bool // Re-process the output and fail if the subtitles change
+	resume         bool // Continue from the checkpoint next to the output
+	raw            bool // Group the source words as is, without the API
+	offline        bool // Guess sentence breaks, without the API
+	verbose        bool // Print the diagnostics of each block
+	blockReport    bool // Write the diagnostics of each block to a CSV file
+}
+
+// usesAPI reports whether the conversion calls the API
+func (o convertOptions) usesAPI() bool {
+	return !o.raw && !o.offline
+}
+
+// processSubtitles converts the captions at inputPath, a file, - for stdin or a
+// URL, filling in report as it goes
+func processSubtitles(ctx context.Context, cfg *config.Config, client *gemini.Client,
+	inputPath, outputPath string, opts convertOptions, report *runReport) error {
+	conv := &yt_enhancer.Converter{
+		Config:         cfg,
+		Client:         client,
+		Raw:            opts.raw,
+		Offline:        opts.offline,
+		Checkpoint:     true,
+		Resume:         opts.resume,
+		StabilityCheck: opts.stabilityCheck,
+		Diagnostics:    opts.verbose || opts.blockReport,
+		Stdout:         stdout,
+	}
+
+	var stats yt_enhancer.Stats
+	var err error
+	if isStreamInput(inputPath) {
+		var wordTimings []models.WordTiming
+		if wordTimings, err = parseStreamInput(inputPath); err != nil {
+			return withExitCode(exitInput, fmt.Errorf("error parsing captions: %w", err))
+		}
+		stats, err = conv.Convert(ctx, wordTimings, outputPath)
+	} else {
+		stats, err = conv.ConvertFile(ctx, inputPath, outputPath)
+	}
+
+	report.WordCount = stats.Words
+	report.BlockCount = stats.Blocks
+	report.PreservationScore = stats.PreservationScore
+	report.Outputs = append(report.Outputs, stats.Outputs...)
+	report.Warnings = append(report.Warnings, stats.Warnings...)
 	if err != nil {
-		return fmt.Errorf("error parsing XML: %w", err)
+		return withExitCode(stageExitCode(err), err)
 	}
 
-	// Extract word timings
-	wordTimings := parser.ExtractWordTimings(timedText)
-	if len(wordTimings) == 0 {
-		return fmt.Errorf("no word timings extracted")
+	// Show the per-block diagnostics for spot-checking the model's output
+	if opts.verbose {
+		fmt.Printf("Blocks of %s:\n", outputPath)
+		if err := printBlockReports(os.Stdout, stats.BlockReports); err != nil {
+			return err
+		}
+	}
+	if opts.blockReport {
+		path := blockReportPath(outputPath)
+		if err := writeBlockReports(path, stats.BlockReports); err != nil {
+			return err
+		}
+		report.Outputs = append(report.Outputs, path)
+		slog.Info("wrote block report", "path", path)
 	}
+	return nil
+}
+
+// stageExitCode returns the exit code for the pipeline stage a conversion failed at
+func stageExitCode(err error) int {
+	var convErr *yt_enhancer.Error
+	if !errors.As(err, &convErr) {
+		return exitFailure
+	}
+	switch convErr.Stage {
+	case yt_enhancer.StageInput:
+		return exitInput
+	case yt_enhancer.StageAPI:
+		return exitAPI
+	case yt_enhancer.StageCheck:
+		return exitCheck
+	default:
+		return exitFailure
+	}
+}
 
-	// Create a Gemini client and generate subtitles
-	client := gemini.NewClient(cfg)
-	subtitles, err := client.CreateSubtitles(wordTimings)
+// printUsageReport prints the API calls, token counts and estimated cost of the run
+func printUsageReport(cfg *config.Config, client *gemini.Client) {
+	usage := client.Usage()
+	summary := fmt.Sprintf("used %d prompt + %d output tokens", usage.PromptTokens, usage.OutputTokens)
+	slog.Info(summary, "calls", usage.APICalls, "prompt_tokens", usage.PromptTokens,
+		"output_tokens", usage.OutputTokens,
+		"estimated_cost", usage.EstimatedCost(cfg.PromptPricePer1K, cfg.OutputPricePer1K))
+}
+
+// parseWordTimings parses the captions at inputPath, a file, - for stdin or a URL,
+// in whichever format they are, splitting multi-word segments if WORD_SPLIT asks for it
+func parseWordTimings(cfg *config.Config, inputPath string) ([]models.WordTiming, error) {
+	var wordTimings []models.WordTiming
+	var err error
+	if isStreamInput(inputPath) {
+		wordTimings, err = parseStreamInput(inputPath)
+	} else {
+		wordTimings, err = parser.ParseWordTimings(inputPath)
+	}
 	if err != nil {
-		return fmt.Errorf("error creating subtitles: %w", err)
+		return nil, err
+	}
+	if cfg.WordSplit == "space" {
+		wordTimings = parser.SplitWords(wordTimings)
+	}
+	if cfg.KeepFormatting {
+		wordTimings = parser.FormatWords(wordTimings)
 	}
+	return wordTimings, nil
+}
+
+// isStreamInput reports whether inputPath is - for stdin or an http(s) URL rather
+// than a file
+func isStreamInput(inputPath string) bool {
+	return inputPath == "-" || strings.HasPrefix(inputPath, "http://") || strings.HasPrefix(inputPath, "https://")
+}
 
-	// Ensure the output directory exists
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("error creating output directory: %w", err)
+// parseStreamInput reads captions from stdin or downloads them from a URL and
+// returns their word timings
+func parseStreamInput(inputPath string) ([]models.WordTiming, error) {
+	if inputPath == "-" {
+		return parser.ParseWordTimingsReader(os.Stdin)
 	}
 
-	// Write SRT file
-	if err := subtitle.WriteSRT(subtitles, outputPath); err != nil {
-		return fmt.Errorf("error writing SRT file: %w", err)
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading captions: %w", err)
 	}
+	defer resp.Body.Close()
 
-	fmt.Printf("Successfully processed %d words into %d subtitle blocks\n",
-		len(wordTimings), len(subtitles))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading captions: %s", resp.Status)
+	}
+	return parser.ParseWordTimingsReader(resp.Body)
+}
+
+// printEstimate prints the batches and tokens processing inputPath would take
+func printEstimate(cfg *config.Config, inputPath string) error {
+	wordTimings, err := parseWordTimings(cfg, inputPath)
+	if err != nil {
+		return withExitCode(exitInput, fmt.Errorf("error parsing captions: %w", err))
+	}
+
+	estimate := gemini.NewClient(cfg).EstimateBatches(wordTimings)
+	usage := gemini.Usage{PromptTokens: estimate.PromptTokens, OutputTokens: estimate.OutputTokens}
+
+	fmt.Printf("Estimate for %s: %d words in %d batches\n", inputPath, len(wordTimings), estimate.Batches)
+	for i, tokens := range estimate.PromptTokensPerBatch {
+		fmt.Printf("  batch %d: ~%d prompt tokens\n", i+1, tokens)
+	}
+	fmt.Printf("Estimated tokens: ~%d prompt, ~%d output, ~%d total, estimated cost $%.4f\n",
+		estimate.PromptTokens, estimate.OutputTokens, estimate.TotalTokens,
+		usage.EstimatedCost(cfg.PromptPricePer1K, cfg.OutputPricePer1K))
 	return nil
 }
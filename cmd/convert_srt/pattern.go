@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"yt_enhancer/pkg/config"
+)
+
+// patternToken matches a {token} in an output pattern
+var patternToken = regexp.MustCompile(`\{[^{}]*\}`)
+
+// patternTokens are the tokens an output pattern may use
+var patternTokens = map[string]bool{"{dir}": true, "{name}": true, "{ext}": true, "{lang}": true}
+
+// langSuffix matches a language code such as "th" or "zh-Hans" at the end of a
+// file name, as in yt-dlp's "video.th.srv3"
+var langSuffix = regexp.MustCompile(`\.([a-z]{2,3}(?:-[A-Za-z]{2,4})?)$`)
+
+// validateOutputPattern checks that pattern only uses known tokens
+func validateOutputPattern(pattern string) error {
+	for _, token := range patternToken.FindAllString(pattern, -1) {
+		if !patternTokens[token] {
+			return fmt.Errorf("unknown token %s in output pattern %q (supported: {dir}, {name}, {ext}, {lang})", token, pattern)
+		}
+	}
+	return nil
+}
+
+// outputPathFor returns the output path for input: OUTPUT_PATTERN expanded for it
+// if set, otherwise the input path with the output extension
+func outputPathFor(cfg *config.Config, input string) string {
+	if cfg.OutputPattern == "" {
+		return strings.TrimSuffix(input, filepath.Ext(input)) + "." + cfg.OutputExtension()
+	}
+	return expandOutputPattern(cfg.OutputPattern, input, cfg.OutputExtension(), cfg.SubtitleLanguages[0])
+}
+
+// expandOutputPattern resolves the tokens of an output pattern for input: {dir} is
+// its directory, {name} its base name without the extension or language suffix,
+// {ext} the output extension and {lang} the language suffix of its name, e.g. "th"
+// for "video.th.srv3", or defaultLang if it has none.
+func expandOutputPattern(pattern, input, ext, defaultLang string) string {
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	lang := defaultLang
+	if m := langSuffix.FindStringSubmatch(name); m != nil {
+		lang = m[1]
+		name = strings.TrimSuffix(name, m[0])
+	}
+
+	return filepath.Clean(strings.NewReplacer(
+		"{dir}", filepath.Dir(input),
+		"{name}", name,
+		"{ext}", ext,
+		"{lang}", lang,
+	).Replace(pattern))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// videoID extracts the YouTube video ID from a URL, returning an empty string if
+// the URL isn't a recognized YouTube video link
+func videoID(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	switch {
+	case host == "youtu.be":
+		return strings.Trim(u.Path, "/")
+	case strings.HasSuffix(host, "youtube.com"):
+		if v := u.Query().Get("v"); v != "" {
+			return v
+		}
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) == 2 && (parts[0] == "shorts" || parts[0] == "live" || parts[0] == "embed") {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// cachedDownload restores the cached srv3 files (and video, if cached) for a video
+// ID into the output directory, returning the restored srv3 paths in the order of
+// langs. It returns no paths when any of the languages isn't cached.
+func cachedDownload(cacheDir, id, outputDir string, langs []string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(cacheDir, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Check that every language is cached before restoring anything
+	cached := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".srv3") {
+			cached[subtitleLanguage(entry.Name())] = filepath.Join(outputDir, entry.Name())
+		}
+	}
+	var srv3Paths []string
+	for _, lang := range langs {
+		path, ok := cached[lang]
+		if !ok {
+			return nil, nil
+		}
+		srv3Paths = append(srv3Paths, path)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		dest := filepath.Join(outputDir, entry.Name())
+		if err := copyFile(filepath.Join(cacheDir, id, entry.Name()), dest); err != nil {
+			return nil, fmt.Errorf("error restoring cached file: %w", err)
+		}
+	}
+	return srv3Paths, nil
+}
+
+// storeDownload copies downloaded srv3 files, their info JSON and optionally the
+// video next to them into the cache directory for a video ID
+func storeDownload(cacheDir, id string, srv3Paths []string, includeVideo bool) error {
+	if len(srv3Paths) == 0 {
+		return nil
+	}
+
+	dir := filepath.Join(cacheDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	// The info JSON and video share the subtitles' base name without the language suffix
+	base := subtitleBase(srv3Paths[0])
+
+	files := append([]string{base + ".info.json"}, srv3Paths...)
+	if includeVideo {
+		video, err := downloadedVideo(base)
+		if err != nil {
+			return err
+		}
+		files = append(files, video)
+	}
+
+	for _, file := range files {
+		if err := copyFile(file, filepath.Join(dir, filepath.Base(file))); err != nil {
+			return fmt.Errorf("error caching %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// videoExtensions lists the containers yt-dlp may write the video in
+var videoExtensions = map[string]bool{
+	".mp4": true, ".mkv": true, ".webm": true, ".mov": true, ".m4v": true, ".flv": true, ".avi": true,
+}
+
+// downloadedVideo returns the path of the video downloaded with base name base,
+// whichever container it was written in
+func downloadedVideo(base string) (string, error) {
+	matches, err := filepath.Glob(base + ".*")
+	if err != nil {
+		return "", err
+	}
+	for _, match := range matches {
+		if videoExtensions[strings.ToLower(filepath.Ext(match))] {
+			return match, nil
+		}
+	}
+	return "", fmt.Errorf("no downloaded video found for %s", base)
+}
+
+// subtitleBase returns the path of a downloaded subtitle file without its
+// ".<lang>.<format>" suffix, which is the base name of the other downloaded files
+func subtitleBase(path string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// subtitleLanguage returns the language code of a subtitle file named
+// <base>.<lang>.<format>
+func subtitleLanguage(path string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return strings.TrimPrefix(filepath.Ext(base), ".")
+}
+
+// copyFile copies src to dst, creating or truncating dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
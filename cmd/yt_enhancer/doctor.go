@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"yt_enhancer/pkg/config"
+	"yt_enhancer/pkg/gemini"
+
+	"github.com/lrstanley/go-ytdlp"
+)
+
+// checkResult is one line of the doctor checklist
+type checkResult struct {
+	name     string
+	ok       bool
+	critical bool // A failure stops the tool from working
+	detail   string
+}
+
+// runDoctor checks the API key, the yt-dlp install and the directories the tool
+// writes to, prints a checklist to w, and fails if a critical check failed
+func runDoctor(ctx context.Context, w io.Writer, envFile, configFile, ytdlpVersion, outDir string) error {
+	var results []checkResult
+
+	// A missing key is reported in the checklist rather than stopping the checks
+	if err := config.LoadEnvFile(envFile); err != nil {
+		results = append(results, checkResult{name: "environment file", detail: err.Error()})
+	}
+	var cfg *config.Config
+	var err error
+	if configFile != "" {
+		cfg, err = config.LoadFile(configFile)
+	} else {
+		cfg, err = config.Load()
+	}
+	if err != nil {
+		results = append(results, checkResult{name: "configuration", critical: true, detail: err.Error()})
+		return printChecklist(w, results)
+	}
+	results = append(results, checkResult{name: "configuration", ok: true, critical: true,
+		detail: fmt.Sprintf("provider %s", cfg.LLMProvider)})
+	if ytdlpVersion != "" {
+		cfg.YtdlpVersion = ytdlpVersion
+	}
+	if outDir != "" {
+		cfg.OutputDir = outDir
+	}
+
+	results = append(results, checkAPI(ctx, cfg))
+	results = append(results, checkYtdlp(ctx, cfg.YtdlpVersion))
+
+	dirs := []struct {
+		name     string
+		path     string
+		critical bool
+	}{
+		{"output directory", cfg.OutputDir, true},
+		{"debug directory", cfg.DebugDir, cfg.DebugMode},
+		{"download cache", cfg.DownloadCacheDir, false},
+		{"response cache", cfg.GeminiCacheDir, false},
+	}
+	for _, dir := range dirs {
+		if dir.path == "" {
+			continue
+		}
+		result := checkResult{name: dir.name, ok: true, critical: dir.critical, detail: dir.path}
+		if err := checkWritable(dir.path); err != nil {
+			result.ok, result.detail = false, err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return printChecklist(w, results)
+}
+
+// checkAPI checks that the provider's API key is set and accepted
+func checkAPI(ctx context.Context, cfg *config.Config) checkResult {
+	result := checkResult{name: "API access", critical: true}
+	if err := cfg.CheckAPIKey(); err != nil {
+		result.detail = err.Error()
+		return result
+	}
+	if err := gemini.NewClient(cfg).CheckAccess(ctx); err != nil {
+		result.detail = err.Error()
+		return result
+	}
+
+	result.ok = true
+	switch cfg.LLMProvider {
+	case "openai":
+		result.detail = "key accepted for " + cfg.OpenAIModel
+	case "ollama":
+		result.detail = "server reachable at " + cfg.OllamaBaseURL
+	default:
+		result.detail = "key accepted for " + cfg.GeminiModel
+	}
+	return result
+}
+
+// checkYtdlp checks that yt-dlp is installed, and at requiredVersion if set,
+// without downloading it
+func checkYtdlp(ctx context.Context, requiredVersion string) checkResult {
+	// yt-dlp is downloaded on the first run, so a missing install isn't critical
+	result := checkResult{name: "yt-dlp"}
+	resolved, err := ytdlp.Install(ctx, &ytdlp.InstallOptions{DisableDownload: true})
+	if err != nil {
+		result.detail = "not installed; it is downloaded on the first run (" + err.Error() + ")"
+		return result
+	}
+	if requiredVersion != "" && resolved.Version != requiredVersion {
+		result.critical = true
+		result.detail = fmt.Sprintf("version %s at %s, but %s is required", resolved.Version, resolved.Executable, requiredVersion)
+		return result
+	}
+
+	result.ok = true
+	result.detail = fmt.Sprintf("version %s at %s", resolved.Version, resolved.Executable)
+	return result
+}
+
+// checkWritable checks that files can be created in dir, creating it if needed
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("can't create %s: %w", dir, err)
+	}
+	file, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return fmt.Errorf("can't write to %s: %w", dir, err)
+	}
+	file.Close()
+	return os.Remove(filepath.Clean(file.Name()))
+}
+
+// printChecklist prints the results and returns an error if a critical check failed
+func printChecklist(w io.Writer, results []checkResult) error {
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		switch {
+		case !r.ok && r.critical:
+			status = "FAIL"
+			failed++
+		case !r.ok:
+			status = "WARN"
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, r.name, r.detail)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d critical checks failed", failed)
+	}
+	fmt.Fprintln(w, "All critical checks passed")
+	return nil
+}
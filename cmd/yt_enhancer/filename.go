@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// templateField matches a yt-dlp output template field such as %(title)s or
+// %(autonumber)03d, or an escaped %%
+var templateField = regexp.MustCompile(`%(\([^()]*\)[-#0+ ]*\d*(\.\d+)?[diouxXeEfFgGcrsaBjlqDSU]|%)`)
+
+// outputTemplate turns a custom filename from the command line into the yt-dlp
+// output template the downloaded files are named with, before the extension. A
+// name with yt-dlp fields, such as %(title)s, is kept as a template once its
+// fields are checked, while any other name is taken literally, with % escaped.
+// Names that could leave the output directory are rejected.
+func outputTemplate(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "" || name == "." || name == "..":
+		return "", fmt.Errorf("invalid custom filename %q", name)
+	case strings.ContainsAny(name, `/\`):
+		return "", fmt.Errorf("custom filename %q can't contain path separators; use -out-dir to pick the directory", name)
+	case strings.ContainsFunc(name, unicode.IsControl):
+		return "", fmt.Errorf("custom filename %q can't contain control characters", name)
+	}
+
+	if !strings.Contains(name, "%(") {
+		return strings.ReplaceAll(name, "%", "%%"), nil
+	}
+
+	// Anything left once the fields are removed is a stray % yt-dlp would choke on
+	if rest := templateField.ReplaceAllString(name, ""); strings.Contains(rest, "%") {
+		return "", fmt.Errorf("custom filename %q has an invalid yt-dlp field; fields look like %%(title)s, and a literal %% is written %%%%", name)
+	}
+	return name, nil
+}
@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"yt_enhancer"
 	"yt_enhancer/pkg/config"
 	"yt_enhancer/pkg/gemini"
+	"yt_enhancer/pkg/logging"
 	"yt_enhancer/pkg/parser"
-	"yt_enhancer/pkg/subtitle"
 
 	"github.com/lrstanley/go-ytdlp"
 )
@@ -26,8 +33,14 @@ const (
 type downloadOptions struct {
 	limitRate    string
 	outputFormat string
-	subLang      string
+	subLangs     []string
 	subFormat    string
+	formatSort   string
+	container    string // Container of the video, empty to keep the source's
+	recode       bool   // Re-encode into container instead of remuxing
+	cookiesFile  string // Cookies file for age-restricted or members-only videos
+	cookiesFrom  string // Browser to read cookies from instead of a file
+	skipVideo    bool   // Only download the subtitles and info JSON
 }
 
 func main() {
@@ -40,161 +53,718 @@ func main() {
 func run() error {
 	// Parse command line flags
 	envFile := flag.String("env", ".env", "Environment file path")
+	configFile := flag.String("config", "", "YAML or JSON config file; environment variables take precedence")
+	ytdlpVersion := flag.String("ytdlp-version", "", "Required yt-dlp version (e.g. 2025.03.31)")
+	urlsFile := flag.String("urls", "", "File listing video URLs to process, one per line")
+	concurrency := flag.Int("concurrency", 1, "Number of videos to process at the same time")
+	splitChapters := flag.Bool("split-chapters", false, "Also write one SRT file per video chapter")
+	langHint := flag.String("lang-hint", "", "Language line of the prompt, e.g. \"Japanese, English (few words)\" (default set from the subtitle language)")
+	savePartial := flag.Bool("save-partial", false, "When a run fails, write the subtitles of the batches that were done to name.partial.srt (name.incomplete.json for JSON)")
+	chapterBatching := flag.Bool("chapter-batching", false, "Keep API batches from crossing video chapter boundaries")
+	refresh := flag.Bool("refresh", false, "Download again even if the video is cached")
+	outDir := flag.String("out-dir", "", "Directory videos and subtitles are written to (default output)")
+	cacheDir := flag.String("cache-dir", "", "Directory caching downloads by video ID (default cache)")
+	deterministic := flag.Bool("deterministic", false, "Use temperature 0 and a fixed seed so runs are reproducible")
+	noCache := flag.Bool("no-cache", false, "Always call the API, ignoring the GEMINI_CACHE_DIR response cache")
+	cacheVideo := flag.Bool("cache-video", false, "Also cache the downloaded video, not just the subtitles")
+	noRecode := flag.Bool("no-recode", false, "Remux the video into -container instead of re-encoding it")
+	keepSrv3 := flag.Bool("keep-srv3", true, "Keep the downloaded srv3 files after a successful run")
+	keepVideo := flag.Bool("keep-video", true, "Keep the downloaded video after a successful run")
+	container := flag.String("container", "", "Container of the downloaded video, e.g. mp4 or mkv (default mp4)")
+	formatSort := flag.String("format-sort", "", "yt-dlp format sort order (default res,ext:mp4:m4a)")
+	cookies := flag.String("cookies", "", "Netscape cookies file for age-restricted or members-only videos")
+	cookiesFromBrowser := flag.String("cookies-from-browser", "", "Browser to read cookies from, e.g. chrome or firefox:profile")
+	subLangs := flag.String("sub-langs", "", "Comma-separated subtitle languages to download and refine, e.g. th,en (default th)")
+	fallbackLangs := flag.String("fallback-langs", "", "Comma-separated subtitle languages to use instead when the video has none of -sub-langs")
+	translate := flag.String("translate", "", "Also write a translation of the subtitles into this language, e.g. en")
+	translateOnly := flag.Bool("translate-only", false, "Write only the translation, not the refined original")
+	bilingual := flag.Bool("bilingual", false, "Write the translation as two-line cues with the original text on the first line")
+	verifyWords := flag.Bool("verify-words", false, "Flag blocks whose text has words that aren't in the source captions")
+	numbering := flag.String("numbering", "", "Cue numbering of chapter files: global or per-file (default global)")
 	flag.Parse()
 
-	// Validate command line arguments
-	if len(flag.Args()) < 1 {
-		return fmt.Errorf("usage: go run main.go <video_url> [custom_filename]")
+	// Check the setup instead of processing videos
+	if flag.Arg(0) == "doctor" {
+		return runDoctor(context.Background(), os.Stdout, *envFile, *configFile, *ytdlpVersion, *outDir)
 	}
 
-	url := flag.Arg(0)
-
-	// Check if custom filename was provided as second argument
-	var customFilename string
-	if len(flag.Args()) > 1 {
-		customFilename = flag.Arg(1)
+	// Collect the URLs to process. A single URL may be followed by a custom filename.
+	urls, customFilename, err := collectURLs(flag.Args(), *urlsFile)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("usage: go run main.go [-urls=file] [-concurrency=n] <video_url> [custom_filename | video_url...], or doctor to check the setup")
 	}
 
 	// Load configuration
-	cfg, err := loadConfig(*envFile)
+	cfg, err := loadConfig(*envFile, *configFile)
 	if err != nil {
 		return err
 	}
 
+	// Override config with command line flags if provided
+	if *ytdlpVersion != "" {
+		cfg.YtdlpVersion = *ytdlpVersion
+	}
+	if *refresh {
+		cfg.RefreshCache = true
+	}
+	if *outDir != "" {
+		cfg.OutputDir = *outDir
+	}
+	if *cacheDir != "" {
+		cfg.DownloadCacheDir = *cacheDir
+	}
+	if *noCache {
+		cfg.GeminiCacheDir = ""
+	}
+	if *deterministic {
+		cfg.Deterministic = true
+	}
+	if *cacheVideo {
+		cfg.CacheVideo = true
+	}
+	if *noRecode {
+		cfg.RecodeVideo = false
+	}
+	if !*keepSrv3 {
+		cfg.KeepSrv3 = false
+	}
+	if !*keepVideo {
+		cfg.KeepVideo = false
+	}
+	if *container != "" {
+		cfg.VideoContainer = *container
+	}
+	if *formatSort != "" {
+		cfg.FormatSort = *formatSort
+	}
+	if *cookies != "" {
+		cfg.CookiesFile = *cookies
+	}
+	if *cookiesFromBrowser != "" {
+		cfg.CookiesFromBrowser = *cookiesFromBrowser
+	}
+	if cfg.CookiesFile != "" && cfg.CookiesFromBrowser != "" {
+		return fmt.Errorf("-cookies and -cookies-from-browser can't be used together")
+	}
+	if cfg.CookiesFile != "" {
+		if _, err := os.Stat(cfg.CookiesFile); err != nil {
+			return fmt.Errorf("error reading cookies file: %w", err)
+		}
+	}
+	if *splitChapters {
+		cfg.SplitChapters = true
+	}
+	if *chapterBatching {
+		cfg.ChapterBatching = true
+	}
+	if *savePartial {
+		cfg.SavePartial = true
+	}
+	if *numbering != "" {
+		cfg.Numbering = *numbering
+	}
+	if langs := config.ParseLanguages(*subLangs); len(langs) > 0 {
+		cfg.SubtitleLanguages = langs
+	}
+	if langs := config.ParseLanguages(*fallbackLangs); len(langs) > 0 {
+		cfg.FallbackLanguages = langs
+	}
+	if *langHint != "" {
+		cfg.LanguageHint = *langHint
+	}
+	if cfg.LanguageHint != "" && len(cfg.SubtitleLanguages) > 1 {
+		return fmt.Errorf("-lang-hint applies to every language, so it can't be used with several -sub-langs")
+	}
+	if *translate != "" {
+		cfg.TranslateTo = *translate
+	}
+	if *translateOnly {
+		cfg.TranslateOnly = true
+	}
+	if *bilingual {
+		cfg.Bilingual = true
+	}
+	if cfg.TranslateOnly && cfg.TranslateTo == "" {
+		return fmt.Errorf("-translate-only requires -translate")
+	}
+	if cfg.Bilingual && cfg.TranslateTo == "" {
+		return fmt.Errorf("-bilingual requires -translate")
+	}
+	if *verifyWords {
+		cfg.VerifyWords = true
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// Log to stdout at the configured level; the download progress bar goes to stderr
+	if err := logging.Setup(os.Stdout, cfg.EffectiveLogLevel(), cfg.LogFormat); err != nil {
+		return err
+	}
+
+	// Cancel downloads and API requests on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	// Install yt-dlp if needed
-	fmt.Println("Checking yt-dlp installation...")
-	ytdlp.MustInstall(context.TODO(), nil)
+	slog.Info("checking yt-dlp installation")
+	resolved, err := installYtdlp(ctx, cfg.YtdlpVersion)
+	if err != nil {
+		return err
+	}
+	slog.Info("using yt-dlp", "version", resolved.Version, "path", resolved.Executable)
 
-	// Download video and subtitles
-	fmt.Printf("Downloading: %s\n", url)
-	srv3Path, err := downloadVideo(url, customFilename)
+	// A single client is shared so that all videos respect the same rate limit
+	client, err := yt_enhancer.NewClient(cfg)
 	if err != nil {
-		return fmt.Errorf("error downloading video: %w", err)
+		return fmt.Errorf("error creating client: %w", err)
+	}
+
+	if len(urls) == 1 {
+		_, err = processURL(ctx, cfg, client, urls[0], customFilename)
+	} else {
+		err = processURLs(ctx, cfg, client, urls, *concurrency)
+	}
+
+	printUsageReport(cfg, client)
+	return err
+}
+
+// urlResult holds the outcome of processing a single video URL
+type urlResult struct {
+	url      string
+	srtPaths []string
+	err      error
+}
+
+// collectURLs gathers video URLs from the positional arguments and an optional
+// URL list file. A custom filename is only accepted for a single URL, and is
+// returned as the yt-dlp output template for it.
+func collectURLs(args []string, urlsFile string) ([]string, string, error) {
+	var urls []string
+	var customFilename string
+
+	for i, arg := range args {
+		if i == 1 && len(args) == 2 && !isURL(arg) {
+			customFilename = arg
+			continue
+		}
+		urls = append(urls, arg)
 	}
-	fmt.Printf("\nDownload complete!\nSaved to: %s\n", srv3Path)
 
-	// Generate SRT file using Gemini API
-	fmt.Println("Recreating subtitles with Gemini API")
-	srtOutputPath := strings.TrimSuffix(srv3Path, ".srv3") + ".srt"
+	if urlsFile != "" {
+		data, err := os.ReadFile(urlsFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading URL list: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			urls = append(urls, line)
+		}
+	}
 
-	if err := processSubtitles(cfg, srv3Path, srtOutputPath); err != nil {
-		return fmt.Errorf("error processing subtitles: %w", err)
+	if customFilename != "" && len(urls) > 1 {
+		return nil, "", fmt.Errorf("a custom filename can only be used with a single URL")
+	}
+	if customFilename != "" {
+		var err error
+		if customFilename, err = outputTemplate(customFilename); err != nil {
+			return nil, "", err
+		}
 	}
 
-	fmt.Printf("Successfully processed and created %s\n", srtOutputPath)
+	return urls, customFilename, nil
+}
+
+// isURL reports whether s looks like an http(s) URL
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// processURLs processes several videos with bounded concurrency, continuing past
+// failures and printing a per-URL summary at the end
+func processURLs(ctx context.Context, cfg *config.Config, client *gemini.Client, urls []string, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]urlResult, len(urls))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, url := range urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			srtPaths, err := processURL(ctx, cfg, client, url, "")
+			results[i] = urlResult{url: url, srtPaths: srtPaths, err: err}
+		}(i, url)
+	}
+	wg.Wait()
+
+	// Report per-URL results
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			slog.Error("video failed", "url", r.url, "error", r.err)
+		} else {
+			slog.Info("video succeeded", "url", r.url, "outputs", strings.Join(r.srtPaths, ", "))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d videos failed", failed, len(urls))
+	}
 	return nil
 }
 
-// loadConfig loads the application configuration
-func loadConfig(envFile string) (*config.Config, error) {
+// processURL downloads a single video and generates a refined subtitle file for
+// each downloaded language, returning their paths
+func processURL(ctx context.Context, cfg *config.Config, client *gemini.Client, url, customFilename string) ([]string, error) {
+	// Download video and subtitles, reusing a cached download when possible
+	srv3Paths, err := downloadOrRestore(ctx, cfg, url, customFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading video: %w", err)
+	}
+
+	// Generate one subtitle file per language, named like name.th.srt
+	var outputPaths []string
+	for _, srv3Path := range srv3Paths {
+		lang := subtitleLanguage(srv3Path)
+		slog.Info("recreating subtitles", "url", url, "language", lang)
+		outputPath := strings.TrimSuffix(srv3Path, ".srv3") + "." + cfg.OutputExtension()
+
+		written, err := processSubtitles(ctx, cfg, client, srv3Path, outputPath, lang)
+		outputPaths = append(outputPaths, written...)
+		if err != nil {
+			return outputPaths, fmt.Errorf("error processing %s subtitles: %w", lang, err)
+		}
+
+		slog.Info("created subtitles", "outputs", strings.Join(written, ", "))
+	}
+
+	// Only clean up after success, so the files of a failed run can be inspected
+	removeIntermediate(cfg, srv3Paths)
+	return outputPaths, nil
+}
+
+// removeIntermediate deletes the downloaded srv3 files and video of a processed
+// video unless the config keeps them. Cached copies are left alone.
+func removeIntermediate(cfg *config.Config, srv3Paths []string) {
+	var files []string
+	if !cfg.KeepSrv3 {
+		files = append(files, srv3Paths...)
+	}
+	if !cfg.KeepVideo && len(srv3Paths) > 0 {
+		if video, err := downloadedVideo(subtitleBase(srv3Paths[0])); err == nil {
+			files = append(files, video)
+		}
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			slog.Warn("failed to remove intermediate file", "path", file, "error", err)
+		} else {
+			slog.Debug("removed intermediate file", "path", file)
+		}
+	}
+}
+
+// loadConfig loads the application configuration from the environment, the .env
+// file and, if given, a config file, in that order of precedence
+func loadConfig(envFile, configFile string) (*config.Config, error) {
 	// Load environment variables from .env file (optional)
 	if err := config.LoadEnvFile(envFile); err != nil {
-		fmt.Printf("Warning: Error loading .env file: %v\n", err)
+		slog.Warn("failed to load .env file", "path", envFile, "error", err)
 	}
 
 	// Load configuration
-	cfg, err := config.Load()
+	var cfg *config.Config
+	var err error
+	if configFile != "" {
+		cfg, err = config.LoadFile(configFile)
+	} else {
+		cfg, err = config.Load()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error loading configuration: %w", err)
 	}
+	if err := cfg.CheckAPIKey(); err != nil {
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
 	return cfg, nil
 }
 
-// downloadVideo downloads a video and returns the subtitle file path
-func downloadVideo(url string, customFilename string) (string, error) {
+// installYtdlp ensures yt-dlp is installed and, if requiredVersion is set,
+// verifies that the resolved binary matches it
+func installYtdlp(ctx context.Context, requiredVersion string) (*ytdlp.ResolvedInstall, error) {
+	// When a version is pinned, keep whatever binary is installed so that a
+	// mismatch is reported instead of silently replaced
+	opts := &ytdlp.InstallOptions{
+		AllowVersionMismatch: requiredVersion != "",
+	}
+
+	resolved, err := ytdlp.Install(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error installing yt-dlp: %w", err)
+	}
+
+	if requiredVersion != "" && resolved.Version != requiredVersion {
+		return nil, fmt.Errorf("yt-dlp version mismatch: required %s, found %s at %s",
+			requiredVersion, resolved.Version, resolved.Executable)
+	}
+
+	return resolved, nil
+}
+
+// printUsageReport prints the API calls, token counts and estimated cost of the run
+func printUsageReport(cfg *config.Config, client *gemini.Client) {
+	usage := client.Usage()
+	summary := fmt.Sprintf("used %d prompt + %d output tokens", usage.PromptTokens, usage.OutputTokens)
+	slog.Info(summary, "calls", usage.APICalls, "prompt_tokens", usage.PromptTokens,
+		"output_tokens", usage.OutputTokens,
+		"estimated_cost", usage.EstimatedCost(cfg.PromptPricePer1K, cfg.OutputPricePer1K))
+}
+
+// downloadOrRestore returns the srv3 paths for a video, one per configured language
+// it has, restoring them from the download cache unless a refresh was requested,
+// and caching fresh downloads
+func downloadOrRestore(ctx context.Context, cfg *config.Config, url, customFilename string) ([]string, error) {
+	id := videoID(url)
+	useCache := cfg.DownloadCacheDir != "" && id != ""
+
+	if useCache && !cfg.RefreshCache {
+		srv3Paths, err := cachedDownload(cfg.DownloadCacheDir, id, cfg.OutputDir, cfg.SubtitleLanguages)
+		if err != nil {
+			slog.Warn("failed to read download cache", "error", err)
+		} else if len(srv3Paths) > 0 {
+			slog.Info("using cached download", "paths", strings.Join(srv3Paths, ", "))
+			return srv3Paths, nil
+		}
+	}
+
+	slog.Info("downloading", "url", url)
+	srv3Paths, err := downloadVideo(ctx, url, customFilename, cfg)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr)
+	slog.Info("download complete", "paths", strings.Join(srv3Paths, ", "))
+
+	if useCache {
+		if err := storeDownload(cfg.DownloadCacheDir, id, srv3Paths, cfg.CacheVideo); err != nil {
+			slog.Warn("failed to cache download", "error", err)
+		}
+	}
+	return srv3Paths, nil
+}
+
+// downloadVideo downloads a video with subtitles in the configured languages and
+// returns the subtitle file paths
+func downloadVideo(ctx context.Context, url string, customFilename string, cfg *config.Config) ([]string, error) {
 	// Determine output format
 	outputPattern := defaultOutputPattern
 	if customFilename != "" {
 		outputPattern = customFilename
 	}
 
-	outputFormat := fmt.Sprintf("output/%s.%%(ext)s", outputPattern)
+	// The directory is part of the yt-dlp template, so a % in it is escaped
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+	outputFormat := filepath.Join(strings.ReplaceAll(cfg.OutputDir, "%", "%%"), outputPattern+".%(ext)s")
 
 	opts := downloadOptions{
 		outputFormat: outputFormat,
-		subLang:      "th",
+		subLangs:     cfg.SubtitleLanguages,
 		subFormat:    "srv3",
+		formatSort:   cfg.FormatSort,
+		container:    cfg.VideoContainer,
+		recode:       cfg.RecodeVideo,
+		cookiesFile:  cfg.CookiesFile,
+		cookiesFrom:  cfg.CookiesFromBrowser,
 	}
 
 	if slowDownload {
 		opts.limitRate = "2M"
 	}
 
-	return executeDownload(context.Background(), url, opts)
+	srv3Paths, err := executeDownload(ctx, url, opts)
+	var noSubs *noSubtitlesError
+	if !errors.As(err, &noSubs) || len(cfg.FallbackLanguages) == 0 {
+		return srv3Paths, err
+	}
+
+	// The video is already downloaded, so only fetch the fallback subtitles
+	slog.Warn("no subtitles in the requested languages, trying the fallback languages",
+		"languages", strings.Join(cfg.SubtitleLanguages, ", "), "fallback", strings.Join(cfg.FallbackLanguages, ", "))
+	opts.subLangs = cfg.FallbackLanguages
+	opts.skipVideo = true
+	return executeDownload(ctx, url, opts)
 }
 
 // executeDownload handles the actual download process with progress reporting
-func executeDownload(ctx context.Context, url string, opts downloadOptions) (string, error) {
+func executeDownload(ctx context.Context, url string, opts downloadOptions) ([]string, error) {
 	// Configure downloader
 	dl := ytdlp.New().
-		FormatSort("res,ext:mp4:m4a").
-		RecodeVideo("mp4").
+		FormatSort(opts.formatSort).
 		ForceOverwrites().
 		WriteThumbnail().
 		WriteInfoJSON().
-		SubLangs(opts.subLang).
+		SubLangs(strings.Join(opts.subLangs, ",")).
 		SubFormat(opts.subFormat).
 		WriteAutoSubs().
 		Output(opts.outputFormat)
 
+	if opts.skipVideo {
+		dl = dl.SkipDownload()
+	}
+
 	if opts.limitRate != "" {
 		dl = dl.LimitRate(opts.limitRate)
 	}
 
-	var subPath string
+	// Authenticate for age-restricted or members-only videos
+	if opts.cookiesFile != "" {
+		dl = dl.Cookies(opts.cookiesFile)
+	}
+	if opts.cookiesFrom != "" {
+		dl = dl.CookiesFromBrowser(opts.cookiesFrom)
+	}
+
+	// Re-encoding guarantees the container's codecs but is slow and lossy, while
+	// remuxing only rewraps the downloaded streams
+	if opts.container != "" {
+		if opts.recode {
+			dl = dl.RecodeVideo(opts.container)
+		} else {
+			dl = dl.RemuxVideo(opts.container)
+		}
+	}
+
+	var progressPath string
 	// Setup progress handler
 	dl = dl.ProgressFunc(100*time.Millisecond, func(prog ytdlp.ProgressUpdate) {
-		fmt.Printf("\r%s %s %.1f%%",
+		fmt.Fprintf(os.Stderr, "\r%s %s %.1f%%",
 			string(prog.Status),
 			prog.Filename,
 			prog.Percent())
 
 		if prog.Status == ytdlp.ProgressStatusFinished && prog.Filename != "" {
-			subPath = prog.Filename
+			progressPath = prog.Filename
 		}
 	})
 
+	// Print the info JSON so the written file names can be derived from it
+	dl = dl.PrintJSON()
+
 	// Run the download
-	_, err := dl.Run(ctx, url)
+	started := time.Now()
+	result, err := dl.Run(ctx, url)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return subPath, nil
+	return locateSubtitles(result, progressPath, opts, started)
 }
 
-// processSubtitles handles the subtitle processing pipeline
-func processSubtitles(cfg *config.Config, inputPath, outputPath string) error {
-	// Parse the XML file
-	timedText, err := parser.ParseXMLFile(inputPath)
-	if err != nil {
-		return fmt.Errorf("error parsing XML: %w", err)
+// downloadInfo holds the fields of yt-dlp's info JSON used to find written files
+type downloadInfo struct {
+	Filename           string                     `json:"filename"`
+	AltFilename        string                     `json:"_filename"`
+	RequestedSubtitles json.RawMessage            `json:"requested_subtitles"`
+	AutomaticCaptions  map[string]json.RawMessage `json:"automatic_captions"`
+	Subtitles          map[string]json.RawMessage `json:"subtitles"`
+}
+
+// noSubtitlesError is returned when a video has no subtitles in any of the
+// requested languages
+type noSubtitlesError struct {
+	requested []string // Languages that were asked for
+	auto      []string // Languages the video has auto-generated captions in
+	manual    []string // Languages the video has uploaded subtitles in
+}
+
+func (e *noSubtitlesError) Error() string {
+	msg := fmt.Sprintf("the video has no auto-generated captions in %s", strings.Join(e.requested, ", "))
+	if len(e.auto) == 0 {
+		msg += "; it has no auto-generated captions at all"
+	} else {
+		msg += "; available: " + strings.Join(e.auto, ", ")
+	}
+	if len(e.manual) > 0 {
+		msg += "; uploaded subtitles (not used): " + strings.Join(e.manual, ", ")
+	}
+	if len(e.auto) > 0 {
+		msg += ". Pass one with -sub-langs or -fallback-langs"
+	}
+	return msg
+}
+
+// availableLanguages returns the sorted languages a video has auto-generated
+// captions and uploaded subtitles in, according to its info JSON. YouTube offers
+// auto-captions machine-translated into every language, so when yt-dlp marks the
+// spoken language with an "-orig" suffix only that language is listed.
+func availableLanguages(infos []downloadInfo) (auto, manual []string) {
+	autoSet := make(map[string]bool)
+	origSet := make(map[string]bool)
+	manualSet := make(map[string]bool)
+	for _, info := range infos {
+		for lang := range info.AutomaticCaptions {
+			autoSet[lang] = true
+			if orig, ok := strings.CutSuffix(lang, "-orig"); ok {
+				origSet[orig] = true
+			}
+		}
+		for lang := range info.Subtitles {
+			if lang != "live_chat" {
+				manualSet[lang] = true
+			}
+		}
 	}
+	if len(origSet) > 0 {
+		autoSet = origSet
+	}
+	return sortedKeys(autoSet), sortedKeys(manualSet)
+}
 
-	// Extract word timings
-	wordTimings := parser.ExtractWordTimings(timedText)
-	if len(wordTimings) == 0 {
-		return fmt.Errorf("no word timings extracted")
+// sortedKeys returns the keys of set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	// Create a Gemini client and generate subtitles
-	client := gemini.NewClient(cfg)
-	subtitles, err := client.CreateSubtitles(wordTimings)
-	if err != nil {
-		return fmt.Errorf("error creating subtitles: %w", err)
+// locateSubtitles finds the subtitle files written by a download, one per requested
+// language that the video has. It fails only if none were written.
+func locateSubtitles(result *ytdlp.Result, progressPath string, opts downloadOptions, started time.Time) ([]string, error) {
+	var infos []downloadInfo
+	for _, log := range result.OutputLogs {
+		if log.JSON == nil {
+			continue
+		}
+		var info downloadInfo
+		if err := json.Unmarshal(*log.JSON, &info); err == nil {
+			infos = append(infos, info)
+		}
 	}
 
-	// Ensure the output directory exists
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("error creating output directory: %w", err)
+	var paths []string
+	for _, lang := range opts.subLangs {
+		path := locateSubtitle(infos, progressPath, opts, lang, started)
+		if path == "" {
+			slog.Warn("no subtitles downloaded for language; the video may not have auto-generated captions in it",
+				"language", lang)
+			continue
+		}
+		paths = append(paths, path)
 	}
 
-	// Write SRT file
-	if err := subtitle.WriteSRT(subtitles, outputPath); err != nil {
-		return fmt.Errorf("error writing SRT file: %w", err)
+	if len(paths) == 0 {
+		if len(infos) == 0 {
+			return nil, fmt.Errorf("no %s subtitles were downloaded; the video may not have auto-generated captions in %s",
+				opts.subFormat, strings.Join(opts.subLangs, ", "))
+		}
+		auto, manual := availableLanguages(infos)
+		return nil, &noSubtitlesError{requested: opts.subLangs, auto: auto, manual: manual}
 	}
+	return paths, nil
+}
 
-	fmt.Printf("Successfully processed %d words into %d subtitle blocks\n",
-		len(wordTimings), len(subtitles))
-	return nil
+// locateSubtitle finds the subtitle file written for one language, returning an
+// empty path if there is none. yt-dlp's info JSON records it under
+// requested_subtitles, and otherwise it is derived from the video file name, since
+// subtitles are named <base>.<lang>.<format>. The last file reported finished by
+// the progress callback is used if it is the subtitle file, and as a last resort
+// the output directory is searched for a matching file written during the download.
+func locateSubtitle(infos []downloadInfo, progressPath string, opts downloadOptions, lang string, started time.Time) string {
+	suffix := "." + lang + "." + opts.subFormat
+
+	for _, info := range infos {
+		var subs map[string]struct {
+			Filepath string `json:"filepath"`
+		}
+		if err := json.Unmarshal(info.RequestedSubtitles, &subs); err == nil {
+			if sub, ok := subs[lang]; ok && fileExists(sub.Filepath) {
+				return sub.Filepath
+			}
+		}
+
+		for _, name := range []string{info.Filename, info.AltFilename} {
+			if name == "" {
+				continue
+			}
+			candidate := strings.TrimSuffix(name, filepath.Ext(name)) + suffix
+			if fileExists(candidate) {
+				return candidate
+			}
+		}
+	}
+
+	if strings.HasSuffix(progressPath, suffix) && fileExists(progressPath) {
+		return progressPath
+	}
+
+	// Fall back to the newest matching file written since the download started
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(opts.outputFormat), "*"+suffix))
+	var newest string
+	var newestTime time.Time
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || info.ModTime().Before(started.Add(-time.Second)) {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest, newestTime = match, info.ModTime()
+		}
+	}
+	return newest
+}
+
+// fileExists reports whether path names an existing regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// processSubtitles converts the srv3 captions at inputPath with the shared client,
+// returning the paths of the files it wrote
+func processSubtitles(ctx context.Context, cfg *config.Config, client *gemini.Client, inputPath, outputPath, lang string) ([]string, error) {
+	conv := &yt_enhancer.Converter{Config: cfg, Client: client, Language: lang}
+	if cfg.ChapterBatching {
+		conv.Boundaries = chapterStarts(inputPath)
+	}
+	stats, err := conv.ConvertFile(ctx, inputPath, outputPath)
+	return stats.Outputs, err
+}
+
+// chapterStarts returns the start times of the chapters in the info JSON written
+// next to the subtitle file at srv3Path, or nil if the video has none
+func chapterStarts(srv3Path string) []int {
+	infoPath := subtitleBase(srv3Path) + ".info.json"
+	chapters, err := parser.ParseChapters(infoPath)
+	if err != nil {
+		slog.Warn("failed to read chapters, batching without them", "path", infoPath, "error", err)
+		return nil
+	}
+
+	starts := make([]int, len(chapters))
+	for i, chapter := range chapters {
+		starts[i] = chapter.StartMs
+	}
+	slog.Debug("batching by chapter", "chapters", len(chapters))
+	return starts
 }
@@ -0,0 +1,575 @@
+// Package yt_enhancer converts YouTube captions into refined subtitle files. It
+// wires the caption parser, the Gemini client and the subtitle writers into the
+// same pipeline the command line tools run, so it can be embedded in other programs.
+package yt_enhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"yt_enhancer/pkg/config"
+	"yt_enhancer/pkg/gemini"
+	"yt_enhancer/pkg/models"
+	"yt_enhancer/pkg/parser"
+	"yt_enhancer/pkg/redact"
+	"yt_enhancer/pkg/subtitle"
+)
+
+// rawMaxDurationMs is the longest span of the blocks raw mode groups words into
+const rawMaxDurationMs = 5000
+
+// Stats summarizes a conversion
+type Stats struct {
+	Words             int      // Words extracted from the captions
+	Blocks            int      // Subtitle blocks written to the main output
+	Batches           int      // Transcript batches sent to the API
+	PreservationScore float64  // Fraction of the source words kept in the subtitles
+	Outputs           []string // Paths of the files written
+	Warnings          []string // Blocks flagged by the quality checks
+
+	// Diagnostics of each block of the main output, if Converter.Diagnostics is set
+	BlockReports []subtitle.BlockReport
+}
+
+// Stage is the step of the pipeline a conversion failed at
+type Stage int
+
+const (
+	StageOutput Stage = iota // Writing the outputs
+	StageInput               // Reading or parsing the captions
+	StageAPI                 // Generating or translating the subtitles
+	StageCheck               // A strict or stability quality check
+)
+
+// Error is a conversion failure along with the stage it happened at
+type Error struct {
+	Stage Stage
+	Err   error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// stageError attaches the pipeline stage to err
+func stageError(stage Stage, err error) error {
+	return &Error{Stage: stage, Err: err}
+}
+
+// ConvertFile converts the captions at inputPath into subtitles written to
+// outputPath, with a new client for cfg
+func ConvertFile(ctx context.Context, cfg *config.Config, inputPath, outputPath string) (Stats, error) {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return Stats{}, fmt.Errorf("error creating client: %w", err)
+	}
+	c := &Converter{Config: cfg, Client: client}
+	return c.ConvertFile(ctx, inputPath, outputPath)
+}
+
+// NewClient creates a Gemini client, enabling PII redaction if configured
+func NewClient(cfg *config.Config) (*gemini.Client, error) {
+	client := gemini.NewClient(cfg)
+	if !cfg.RedactPII {
+		return client, nil
+	}
+
+	patterns := redact.DefaultPatterns
+	if cfg.RedactPatternsFile != "" {
+		var err error
+		if patterns, err = redact.LoadPatterns(cfg.RedactPatternsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := client.EnableRedaction(patterns); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Converter runs conversions with a client that may be shared with other
+// conversions, so that they respect the same rate limit
+type Converter struct {
+	Config *config.Config
+	Client *gemini.Client
+
+	// Language of the captions, such as "th" or "en", which sets the prompt's
+	// Language line. Empty uses the default Thai prompt.
+	Language string
+
+	// Boundaries are times in ms, such as chapter starts, that no batch sent to
+	// the API crosses
+	Boundaries []int
+
+	// Raw groups the source words into blocks as is, without calling the API
+	Raw bool
+
+	// Offline groups the source words into sentence-like blocks at pauses and
+	// punctuation, without calling the API, for when it is down or out of quota
+	Offline bool
+
+	// Checkpoint saves progress next to the output after each batch, and Resume
+	// continues an interrupted run from it
+	Checkpoint bool
+	Resume     bool
+
+	// StabilityCheck re-processes the subtitles and fails if they change
+	StabilityCheck bool
+
+	// Diagnostics fills in Stats.BlockReports. The reports are taken before the
+	// timings are shifted, scaled or clipped, so they line up with the source words.
+	Diagnostics bool
+
+	// Stdout is where an output path of "-" writes; nil means os.Stdout
+	Stdout io.Writer
+}
+
+// ConvertFile converts the captions at inputPath, in whichever format they are,
+// into subtitles written to outputPath, or to Stdout when it is "-". The returned
+// stats cover the work done before any failure.
+func (c *Converter) ConvertFile(ctx context.Context, inputPath, outputPath string) (Stats, error) {
+	wordTimings, err := parser.ParseWordTimings(inputPath)
+	if err != nil {
+		return Stats{}, stageError(StageInput, fmt.Errorf("error parsing captions: %w", err))
+	}
+	return c.convert(ctx, wordTimings, inputPath, outputPath)
+}
+
+// Convert is ConvertFile for captions that were already parsed, such as ones read
+// from stdin or a URL
+func (c *Converter) Convert(ctx context.Context, wordTimings []models.WordTiming, outputPath string) (Stats, error) {
+	return c.convert(ctx, wordTimings, "", outputPath)
+}
+
+// convert runs the pipeline on the word timings of the captions at inputPath,
+// which is empty when they didn't come from a file
+func (c *Converter) convert(ctx context.Context, wordTimings []models.WordTiming, inputPath, outputPath string) (Stats, error) {
+	cfg := c.Config
+	var stats Stats
+
+	// Name the debug files after the input so that conversions sharing the
+	// client's debug directory can be told apart
+	if inputPath != "" {
+		ctx = gemini.WithDebugName(ctx, strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath)))
+	}
+
+	// Split multi-word segments and keep emphasis as tags if configured
+	if cfg.WordSplit == "space" {
+		wordTimings = parser.SplitWords(wordTimings)
+	}
+	if cfg.KeepFormatting {
+		wordTimings = parser.FormatWords(wordTimings)
+	}
+
+	// Point the model at words the captions weren't sure of
+	if cfg.LowConfidence > 0 {
+		wordTimings = parser.MarkUncertain(wordTimings, cfg.LowConfidence)
+	}
+	if len(wordTimings) == 0 {
+		return stats, stageError(StageInput, fmt.Errorf("no word timings extracted"))
+	}
+	stats.Words = len(wordTimings)
+
+	// Generate subtitles, saving progress next to the output if requested, or
+	// group the source words as is in raw mode
+	var subtitles []models.Subtitle
+	var err error
+	checkpointPath := ""
+	run := gemini.RunOptions{
+		Language:   c.Language,
+		Boundaries: c.Boundaries, // Keep batches from crossing chapters or other boundaries
+		// Count this run's batches; others may share the client
+		OnProgress: func(batchNum, _, _, _ int) {
+			stats.Batches = max(stats.Batches, batchNum)
+		},
+	}
+	switch {
+	case c.Raw:
+		subtitles = subtitle.GroupWords(wordTimings, subtitle.GroupOptions{
+			MaxWords:      cfg.RawMaxWords,
+			MaxDurationMs: rawMaxDurationMs,
+			PauseMs:       cfg.RawPauseMs,
+			MinDurationMs: cfg.RawMinBlockMs,
+			GapMs:         cfg.SubtitleGapMs,
+			LastWordPadMs: cfg.LastWordPadMs,
+		})
+	case c.Offline:
+		subtitles = subtitle.TimeGroups(subtitle.InferBreaks(wordTimings, cfg.RawPauseMs), subtitle.GroupOptions{
+			PauseMs:       cfg.RawPauseMs,
+			MinDurationMs: cfg.RawMinBlockMs,
+			GapMs:         cfg.SubtitleGapMs,
+			LastWordPadMs: cfg.LastWordPadMs,
+		})
+	default:
+		if c.Checkpoint && outputPath != "-" {
+			checkpointPath = gemini.CheckpointPath(outputPath)
+			run.CheckpointPath, run.Resume = checkpointPath, c.Resume
+		}
+		subtitles, err = c.Client.CreateSubtitlesWithOptions(ctx, wordTimings, run)
+	}
+	if err != nil {
+		// Keep the batches that were done if the run failed partway through
+		if cfg.SavePartial && outputPath != "-" {
+			stats.Outputs = append(stats.Outputs, c.savePartial(err, outputPath)...)
+		}
+		return stats, stageError(StageAPI, fmt.Errorf("error creating subtitles: %w", err))
+	}
+	stats.PreservationScore = subtitle.PreservationScore(wordTimings, subtitles)
+
+	// Catch words the model added to the source captions
+	if cfg.VerifyWords {
+		warnings, err := checkAddedWords(cfg, wordTimings, subtitles)
+		stats.Warnings = append(stats.Warnings, warnings...)
+		if err != nil {
+			return stats, stageError(StageCheck, err)
+		}
+	}
+
+	// List the blocks built from low-confidence words for review
+	if cfg.LowConfidence > 0 {
+		stats.Warnings = append(stats.Warnings, checkUncertainWords(wordTimings, subtitles)...)
+	}
+
+	// Feed the result back through the pipeline to make sure it is stable
+	if c.StabilityCheck {
+		if err := checkStability(ctx, c.Client, subtitles); err != nil {
+			return stats, stageError(StageCheck, err)
+		}
+	}
+
+	// Collapse repeated blocks into one if requested
+	subtitles = subtitle.MergeDuplicates(subtitles, cfg.MergeDuplicatesGapMs)
+
+	// Split blocks that stay on screen too long to read
+	subtitles = subtitle.SplitLongBlocks(subtitles, cfg.MaxBlockDurationMs)
+
+	// Keep fast blocks on screen long enough to read
+	subtitles = subtitle.EnforceReadingSpeed(subtitles, cfg.MaxCPS, cfg.MaxCPSThai, cfg.SubtitleGapMs)
+
+	// Catch blocks whose timing can't match their text
+	warnings, err := checkTiming(cfg, subtitles)
+	stats.Warnings = append(stats.Warnings, warnings...)
+	if err != nil {
+		return stats, stageError(StageCheck, err)
+	}
+
+	// Normalize sentence-ending punctuation if requested
+	if cfg.NormalizePunctuation {
+		subtitles = subtitle.NormalizeSentencePunctuation(subtitles)
+	}
+
+	// Translate the finished blocks if requested; the translation keeps their timings
+	var translation []models.Subtitle
+	if cfg.TranslateTo != "" {
+		translation, err = c.Client.TranslateSubtitles(ctx, subtitles, cfg.TranslateTo)
+		if err != nil {
+			return stats, stageError(StageAPI, fmt.Errorf("error translating subtitles: %w", err))
+		}
+		if cfg.Bilingual {
+			translation = subtitle.CombineBilingual(subtitles, translation)
+		}
+	}
+
+	// Describe each block for spot-checks while its timings still match the source
+	if c.Diagnostics {
+		stats.BlockReports = subtitle.ReportBlocks(subtitles, wordTimings)
+	}
+
+	subtitles = finishTrack(cfg, subtitles)
+	stats.Blocks = len(subtitles)
+
+	// Write the subtitles in the configured format
+	if !cfg.TranslateOnly {
+		written, err := c.writeTrack(subtitles, inputPath, outputPath)
+		stats.Outputs = append(stats.Outputs, written...)
+		if err != nil {
+			return stats, stageError(StageOutput, err)
+		}
+	}
+	if translation != nil {
+		translationPath := subtitle.TranslatedPath(outputPath, cfg.TranslateTo)
+		written, err := c.writeTrack(finishTrack(cfg, translation), inputPath, translationPath)
+		stats.Outputs = append(stats.Outputs, written...)
+		if err != nil {
+			return stats, stageError(StageOutput, err)
+		}
+	}
+
+	// The outputs are complete, so the checkpoint is no longer needed
+	if checkpointPath != "" {
+		if err := gemini.RemoveCheckpoint(checkpointPath); err != nil {
+			slog.Warn("failed to remove checkpoint", "path", checkpointPath, "error", err)
+		}
+	}
+
+	slog.Info("processed subtitles", "words", len(wordTimings), "subtitles", len(subtitles))
+	return stats, nil
+}
+
+// savePartial writes the blocks of a failed run that were done, if err holds any,
+// to partialPath of the output path in each output format. It returns the paths written.
+func (c *Converter) savePartial(err error, outputPath string) []string {
+	var partial *gemini.PartialError
+	if !errors.As(err, &partial) {
+		return nil
+	}
+	subtitles := finishTrack(c.Config, partial.Subtitles)
+
+	// Chapter files of a partial run would be misleading, so pass no input path.
+	// Each format is written on its own, as only the JSON file is named differently.
+	var written []string
+	var writeErr error
+	if len(c.Config.OutputFormats) == 0 {
+		written, writeErr = c.writeTrack(subtitles, "", partialPath(outputPath))
+	} else {
+		base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+		for _, format := range c.Config.OutputFormats {
+			cfg := *c.Config
+			cfg.OutputFormats = nil
+			cfg.OutputFormat = format
+			conv := *c
+			conv.Config = &cfg
+
+			var paths []string
+			paths, writeErr = conv.writeTrack(subtitles, "", partialPath(base+"."+strings.ToLower(format)))
+			written = append(written, paths...)
+			if writeErr != nil {
+				break
+			}
+		}
+	}
+	if writeErr != nil {
+		slog.Warn("failed to save partial subtitles", "error", writeErr)
+	}
+	if len(written) > 0 {
+		slog.Warn("saved partial subtitles", "paths", strings.Join(written, ", "), "subtitles", len(partial.Subtitles))
+	}
+	return written
+}
+
+// partialPath returns the path the subtitles of a failed run are saved to for
+// the output path, e.g. name.partial.srt for name.srt. JSON output goes to
+// name.incomplete.json instead, as name.partial.json is the checkpoint.
+func partialPath(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	if strings.EqualFold(ext, ".json") {
+		return strings.TrimSuffix(outputPath, ext) + ".incomplete" + ext
+	}
+	return strings.TrimSuffix(outputPath, ext) + ".partial" + ext
+}
+
+// finishTrack applies the final layout passes to a subtitle track before it is written
+func finishTrack(cfg *config.Config, subtitles []models.Subtitle) []models.Subtitle {
+	// Insert placeholder cues for long silences if requested
+	subtitles = subtitle.InsertSilenceCues(subtitles, cfg.SilenceGapMs, cfg.SilenceMarker)
+
+	// Balance the emphasis tags of spans split across blocks
+	if cfg.KeepFormatting {
+		subtitles = subtitle.CleanTags(subtitles)
+	}
+
+	// Wrap long subtitle text onto multiple lines
+	subtitles = subtitle.WrapLines(subtitles, cfg.MaxLineLength, cfg.MaxLines)
+
+	// Mark right-to-left lines once the line breaks are final
+	if cfg.RTLMarkers {
+		subtitles = subtitle.MarkRTL(subtitles)
+	}
+
+	// Fix a constant sync offset against the video
+	if cfg.ShiftMs != 0 {
+		subtitles = subtitle.ShiftTiming(subtitles, cfg.ShiftMs)
+	}
+
+	// Fix drift that grows over the video, after any constant offset
+	if cfg.ScaleFactor != 1 {
+		subtitles = subtitle.ScaleTiming(subtitles, cfg.ScaleFactor, cfg.ScaleAnchorMs)
+	}
+
+	// Keep only the requested time range
+	if cfg.ClipSinceMs > 0 || cfg.ClipUntilMs > 0 {
+		subtitles = subtitle.FilterRange(subtitles, cfg.ClipSinceMs, cfg.ClipUntilMs, cfg.ClipRebase)
+	}
+	return subtitles
+}
+
+// writeTrack writes a finished subtitle track to outputPath, or to Stdout when it
+// is "-", along with one file per chapter if requested. With several output
+// formats configured, each is written next to outputPath under its own extension
+// instead. It returns the paths of the subtitle files written.
+func (c *Converter) writeTrack(subtitles []models.Subtitle, inputPath, outputPath string) ([]string, error) {
+	cfg := c.Config
+	if outputPath == "-" {
+		stdout := c.Stdout
+		if stdout == nil {
+			stdout = os.Stdout
+		}
+		if err := subtitle.WriteFormatTo(stdout, subtitles, cfg.OutputFormat); err != nil {
+			return nil, fmt.Errorf("error writing to stdout: %w", err)
+		}
+		return []string{outputPath}, nil
+	}
+
+	// Ensure the output directory exists
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	// Write every configured format from the same blocks, or else the format the
+	// extension names, unless the configured format was given another extension
+	var written []string
+	var err error
+	switch {
+	case len(cfg.OutputFormats) > 0:
+		written, err = subtitle.WriteFormats(subtitles, strings.TrimSuffix(outputPath, filepath.Ext(outputPath)), cfg.OutputFormats)
+		for _, path := range written {
+			slog.Info("wrote subtitles", "path", path)
+		}
+	case subtitle.FormatFromPath(outputPath) == cfg.OutputFormat:
+		if err = subtitle.WriteSubtitles(subtitles, outputPath); err == nil {
+			written = []string{outputPath}
+		}
+	default:
+		if err = subtitle.WriteFormat(subtitles, outputPath, cfg.OutputFormat); err == nil {
+			written = []string{outputPath}
+		}
+	}
+	if err != nil {
+		return written, fmt.Errorf("error writing output file: %w", err)
+	}
+
+	// Write one file per chapter if requested; chapters come from the info JSON
+	// next to the input, so captions that aren't from a file have none
+	if cfg.SplitChapters && inputPath != "" {
+		if err := writeChapterFiles(cfg, subtitles, inputPath, outputPath); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// writeChapterFiles splits subtitles by the chapters listed in the video's info JSON
+// and writes each chapter to its own numbered SRT file next to outputPath
+func writeChapterFiles(cfg *config.Config, subtitles []models.Subtitle, inputPath, outputPath string) error {
+	// The info JSON shares the subtitle's base name without the language suffix
+	base := strings.TrimSuffix(inputPath, ".srv3")
+	infoPath := strings.TrimSuffix(base, filepath.Ext(base)) + ".info.json"
+
+	chapters, err := parser.ParseChapters(infoPath)
+	if err != nil {
+		return fmt.Errorf("error reading chapters: %w", err)
+	}
+	if len(chapters) == 0 {
+		slog.Info("video has no chapters, skipping chapter split")
+		return nil
+	}
+
+	outBase := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	number := 1
+	for i, part := range subtitle.SplitByChapters(subtitles, chapters) {
+		if cfg.Numbering == "per-file" {
+			number = 1
+		}
+
+		chapterPath := fmt.Sprintf("%s.ch%02d.srt", outBase, i+1)
+		if err := subtitle.WriteSRTNumbered(part, chapterPath, number); err != nil {
+			return fmt.Errorf("error writing chapter file: %w", err)
+		}
+		number += len(part)
+
+		slog.Info("wrote chapter", "chapter", i+1, "title", chapters[i].Title, "path", chapterPath)
+	}
+	return nil
+}
+
+// checkTiming warns about blocks with an implausible words-per-second rate and
+// fails in strict mode. It returns the warnings it logged.
+func checkTiming(cfg *config.Config, subtitles []models.Subtitle) ([]string, error) {
+	var warnings []string
+	flagged := subtitle.FlagImplausibleTiming(subtitles, cfg.MaxWordsPerSecond)
+	for _, i := range flagged {
+		sub := subtitles[i]
+		warning := fmt.Sprintf("block %d (%d-%dms) exceeds %.1f words/second: %q",
+			i+1, sub.StartMs, sub.EndMs, cfg.MaxWordsPerSecond, sub.Text)
+		slog.Warn("implausible timing", "block", i+1, "start_ms", sub.StartMs, "end_ms", sub.EndMs,
+			"max_wps", cfg.MaxWordsPerSecond, "text", sub.Text)
+		warnings = append(warnings, warning)
+	}
+
+	if cfg.Strict && len(flagged) > 0 {
+		return warnings, fmt.Errorf("%d subtitle blocks have implausible timing", len(flagged))
+	}
+	return warnings, nil
+}
+
+// checkAddedWords warns about blocks whose text has words that aren't in the
+// source captions and fails in strict mode. It returns the warnings it logged.
+func checkAddedWords(cfg *config.Config, words []models.WordTiming, subtitles []models.Subtitle) ([]string, error) {
+	var warnings []string
+	flagged := subtitle.FindAddedWords(subtitles, words)
+	for _, added := range flagged {
+		sub := subtitles[added.Block]
+		warning := fmt.Sprintf("block %d (%d-%dms) has words not in the source: %s: %q",
+			added.Block+1, sub.StartMs, sub.EndMs, strings.Join(added.Words, ", "), sub.Text)
+		slog.Warn("words not in source", "block", added.Block+1, "start_ms", sub.StartMs, "end_ms", sub.EndMs,
+			"words", added.Words, "text", sub.Text)
+		warnings = append(warnings, warning)
+	}
+
+	if cfg.Strict && len(flagged) > 0 {
+		return warnings, fmt.Errorf("%d subtitle blocks have words not in the source", len(flagged))
+	}
+	return warnings, nil
+}
+
+// checkUncertainWords warns about blocks built from source words recognized with
+// low confidence. It returns the warnings it logged.
+func checkUncertainWords(words []models.WordTiming, subtitles []models.Subtitle) []string {
+	var warnings []string
+	for _, uncertain := range subtitle.FindUncertainWords(subtitles, words) {
+		sub := subtitles[uncertain.Block]
+		warning := fmt.Sprintf("block %d (%d-%dms) has low-confidence source words: %s: %q",
+			uncertain.Block+1, sub.StartMs, sub.EndMs, strings.Join(uncertain.Words, ", "), sub.Text)
+		slog.Warn("low-confidence words", "block", uncertain.Block+1, "start_ms", sub.StartMs, "end_ms", sub.EndMs,
+			"words", uncertain.Words, "text", sub.Text)
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// checkStability re-processes the generated subtitles and returns an error if the
+// second pass changes them, which indicates prompt instability or over-correction
+func checkStability(ctx context.Context, client *gemini.Client, subtitles []models.Subtitle) error {
+	slog.Info("running stability check")
+
+	again, err := client.CreateSubtitles(ctx, parser.SubtitlesToWordTimings(subtitles, ""))
+	if err != nil {
+		return fmt.Errorf("error re-processing subtitles for stability check: %w", err)
+	}
+
+	changed := subtitle.ChangedTexts(subtitles, again)
+	if len(changed) == 0 {
+		slog.Info("stability check passed")
+		return nil
+	}
+
+	for _, change := range changed {
+		var before, after string
+		if change.Before >= 0 {
+			before = subtitles[change.Before].Text
+		}
+		if change.After >= 0 {
+			after = again[change.After].Text
+		}
+		slog.Warn("block changed on re-processing", "block", change.Before+1, "reprocessed_block", change.After+1,
+			"before", before, "after", after)
+	}
+	return fmt.Errorf("stability check failed: %d of %d subtitle blocks changed on re-processing",
+		len(changed), len(subtitles))
+}
@@ -0,0 +1,243 @@
+package yt_enhancer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"yt_enhancer/pkg/config"
+	"yt_enhancer/pkg/gemini"
+	"yt_enhancer/pkg/models"
+)
+
+// wholeBatch answers a batch with a single block holding all of its words
+func wholeBatch(words []models.WordTiming) []models.SubtitleInput {
+	var texts []string
+	for _, word := range words {
+		texts = append(texts, word.Word)
+	}
+	return []models.SubtitleInput{{
+		StartWordIndex:  words[0].ID,
+		StartMs:         words[0].StartTime,
+		LastWordStartMs: words[len(words)-1].StartTime,
+		Text:            strings.Join(texts, " "),
+	}}
+}
+
+// newBatchServer starts a stand-in for the Gemini API that answers each batch
+// with the blocks reply returns for its words
+func newBatchServer(t *testing.T, reply func(words []models.WordTiming) []models.SubtitleInput) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Contents []struct {
+				Parts []gemini.Part `json:"parts"`
+			} `json:"contents"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Contents) == 0 || len(req.Contents[0].Parts) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		// The batch's words are the JSON array at the end of the prompt
+		prompt := req.Contents[0].Parts[0].Text
+		data := prompt[strings.Index(prompt, "TRANSCRIPT DATA:"):]
+		var words []models.WordTiming
+		if err := json.Unmarshal([]byte(data[strings.Index(data, "["):]), &words); err != nil || len(words) == 0 {
+			http.Error(w, "bad transcript", http.StatusBadRequest)
+			return
+		}
+		content, _ := json.Marshal(reply(words))
+
+		var resp gemini.Response
+		resp.Candidates = make([]gemini.Candidate, 1)
+		resp.Candidates[0].Content.Parts = []gemini.Part{{Text: string(content)}}
+		resp.Candidates[0].FinishReason = "STOP"
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestConfig returns the default configuration with a placeholder API key,
+// the response cache off and batches of 20 words
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	t.Setenv("GEMINI_API_KEY", "test-key")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	cfg.GeminiCacheDir = ""
+	cfg.GeminiBatchSize = 20
+	return cfg
+}
+
+// testWords returns n words, one every 500ms
+func testWords(n int) []models.WordTiming {
+	words := make([]models.WordTiming, n)
+	for i := range words {
+		words[i] = models.WordTiming{ID: i, Word: fmt.Sprintf("w%d", i), StartTime: i * 500}
+	}
+	return words
+}
+
+func TestConvertCountsBatchesPerRun(t *testing.T) {
+	cfg := newTestConfig(t)
+	client := gemini.NewClient(cfg)
+	client.SetBaseURL(newBatchServer(t, wholeBatch).URL)
+	conv := &Converter{Config: cfg, Client: client}
+	dir := t.TempDir()
+
+	// Conversions of different lengths share the client at the same time
+	wantBatches := []int{1, 2, 3, 1, 2, 3}
+	got := make([]int, len(wantBatches))
+	errs := make([]error, len(wantBatches))
+	var wg sync.WaitGroup
+	for i, batches := range wantBatches {
+		words := testWords(batches * cfg.GeminiBatchSize)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stats, err := conv.Convert(context.Background(), words, filepath.Join(dir, fmt.Sprintf("out%d.srt", i)))
+			got[i], errs[i] = stats.Batches, err
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range wantBatches {
+		if errs[i] != nil {
+			t.Fatalf("conversion %d: %v", i, errs[i])
+		}
+		if got[i] != wantBatches[i] {
+			t.Errorf("conversion %d sent %d batches, want %d", i, got[i], wantBatches[i])
+		}
+	}
+	if total := client.Usage().Batches; total != 12 {
+		t.Errorf("client sent %d batches in all, want 12", total)
+	}
+}
+
+func TestSavePartialKeepsCheckpoint(t *testing.T) {
+	// The second batch keeps coming back with an st_id outside it
+	srv := newBatchServer(t, func(words []models.WordTiming) []models.SubtitleInput {
+		blocks := wholeBatch(words)
+		if words[0].ID > 0 {
+			blocks[0].StartWordIndex = 0
+		}
+		return blocks
+	})
+	cfg := newTestConfig(t)
+	cfg.SavePartial = true
+	cfg.OutputFormats = []string{"srt", "json"}
+	client := gemini.NewClient(cfg)
+	client.SetBaseURL(srv.URL)
+	conv := &Converter{Config: cfg, Client: client, Checkpoint: true}
+
+	output := filepath.Join(t.TempDir(), "video.srt")
+	stats, err := conv.Convert(context.Background(), testWords(40), output)
+	if err == nil {
+		t.Fatal("Convert succeeded, want an error")
+	}
+
+	base := strings.TrimSuffix(output, ".srt")
+	wantOutputs := []string{base + ".partial.srt", base + ".incomplete.json"}
+	if !reflect.DeepEqual(stats.Outputs, wantOutputs) {
+		t.Errorf("outputs = %q, want %q", stats.Outputs, wantOutputs)
+	}
+
+	// The checkpoint still holds the first batch for -resume
+	data, err := os.ReadFile(gemini.CheckpointPath(output))
+	if err != nil {
+		t.Fatalf("reading checkpoint: %v", err)
+	}
+	var checkpoint struct {
+		Ranges []struct {
+			Next int `json:"next"`
+		} `json:"ranges"`
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		t.Fatalf("checkpoint isn't a checkpoint: %v\n%s", err, data)
+	}
+	if len(checkpoint.Ranges) != 1 || checkpoint.Ranges[0].Next != 20 {
+		t.Errorf("checkpoint = %s, want the first 20 words done", data)
+	}
+}
+
+// fiveWordBlocks answers a batch with a block for every five of its words, their
+// text passed through rewrite
+func fiveWordBlocks(rewrite func(string) string) func([]models.WordTiming) []models.SubtitleInput {
+	return func(words []models.WordTiming) []models.SubtitleInput {
+		var blocks []models.SubtitleInput
+		for start := 0; start < len(words); start += 5 {
+			block := wholeBatch(words[start:min(start+5, len(words))])[0]
+			block.Text = rewrite(block.Text)
+			blocks = append(blocks, block)
+		}
+		return blocks
+	}
+}
+
+func TestConvertStabilityCheck(t *testing.T) {
+	echo := func(text string) string { return text }
+	// Toggling the case of w7 changes its block again on every pass
+	toggle := strings.NewReplacer("w7", "W7", "W7", "w7").Replace
+
+	tests := []struct {
+		name        string
+		rewrite     func(string) string
+		wantChanged []int // Blocks reported as changed
+	}{
+		{name: "model echoes its input", rewrite: echo},
+		{name: "model rewrites text", rewrite: toggle, wantChanged: []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Record the changed blocks the check logs
+			var logs bytes.Buffer
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+			cfg := newTestConfig(t)
+			client := gemini.NewClient(cfg)
+			client.SetBaseURL(newBatchServer(t, fiveWordBlocks(tt.rewrite)).URL)
+			conv := &Converter{Config: cfg, Client: client, StabilityCheck: true}
+
+			_, err := conv.Convert(context.Background(), testWords(20), filepath.Join(t.TempDir(), "out.srt"))
+			var convErr *Error
+			switch {
+			case tt.wantChanged == nil && err != nil:
+				t.Fatalf("Convert: %v", err)
+			case tt.wantChanged != nil && (!errors.As(err, &convErr) || convErr.Stage != StageCheck):
+				t.Fatalf("Convert error = %v, want a failed stability check", err)
+			}
+
+			var changed []int
+			for _, line := range bytes.Split(logs.Bytes(), []byte("\n")) {
+				var entry struct {
+					Msg   string `json:"msg"`
+					Block int    `json:"block"`
+				}
+				if json.Unmarshal(line, &entry) == nil && entry.Msg == "block changed on re-processing" {
+					changed = append(changed, entry.Block)
+				}
+			}
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("changed blocks = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ module yt_enhancer
 
 go 1.24.0
 
-require github.com/lrstanley/go-ytdlp v0.0.0-20250401014907-da1707e4fb85
+require (
+	github.com/lrstanley/go-ytdlp v0.0.0-20250401014907-da1707e4fb85
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/ProtonMail/go-crypto v1.1.6 // indirect
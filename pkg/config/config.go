@@ -2,56 +2,620 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
-// Config holds application configuration
+// Config holds application configuration. The yaml and json tags are the keys of
+// a config file (see LoadFile): each setting's environment variable name in lower
+// case. Settings tagged "-" are either not read from a file, or are parsed by
+// LoadFile as their environment variables are.
 type Config struct {
-	GeminiAPIKey      string
-	GeminiModel       string
-	GeminiTemperature float64
-	GeminiMaxTokens   int
-	DebugMode         bool   `env:"DEBUG_MODE" envDefault:"false"`
-	DebugDir          string `env:"DEBUG_DIR" envDefault:"debug"`
+	LLMProvider             string            `yaml:"llm_provider" json:"llm_provider"` // Backend used to generate subtitles ("gemini", "openai" or "ollama")
+	GeminiAPIKey            string            `yaml:"gemini_api_key" json:"gemini_api_key"`
+	GeminiModel             string            `yaml:"gemini_model" json:"gemini_model"`
+	GeminiBaseURL           string            `yaml:"gemini_base_url" json:"gemini_base_url"`       // Gemini API server, without the version path
+	GeminiAPIVersion        string            `yaml:"gemini_api_version" json:"gemini_api_version"` // Gemini API version path, e.g. v1beta or v1
+	GeminiTemperature       float64           `yaml:"gemini_temperature" json:"gemini_temperature"`
+	Deterministic           bool              `yaml:"deterministic" json:"deterministic"` // Use temperature 0 and a fixed seed for reproducible output
+	GeminiMaxTokens         int               `yaml:"gemini_max_tokens" json:"gemini_max_tokens"`
+	GeminiRequestsPerMinute int               `yaml:"gemini_rpm" json:"gemini_rpm"`                         // Maximum API requests started per minute (0 is unlimited)
+	GeminiRequestTimeout    int               `yaml:"gemini_request_timeout" json:"gemini_request_timeout"` // Seconds allowed per Gemini request (0 scales with the batch size)
+	GeminiCacheDir          string            `yaml:"gemini_cache_dir" json:"gemini_cache_dir"`             // Directory caching model replies by prompt hash (empty disables)
+	GeminiProxy             string            `yaml:"gemini_proxy" json:"gemini_proxy"`                     // Proxy URL for Gemini requests: http, https or socks5 (empty uses HTTPS_PROXY)
+	GeminiSafety            map[string]string `yaml:"-" json:"-"`                                           // Block threshold per Gemini harm category; empty keeps the API's defaults
+	GeminiPromptFile        string            `yaml:"gemini_prompt_file" json:"gemini_prompt_file"`         // text/template file replacing the built-in batch prompt
+	LanguageHint            string            `yaml:"language_hint" json:"language_hint"`                   // Replaces the prompt's Language line, e.g. "Japanese, English (few words)"
+	GeminiConcurrency       int               `yaml:"gemini_concurrency" json:"gemini_concurrency"`         // Number of batches processed in parallel
+	GeminiBatchSize         int               `yaml:"gemini_batch_size" json:"gemini_batch_size"`           // Words per batch (0 uses the provider default: 300, or 100 for Ollama)
+	GeminiBatchOverlap      int               `yaml:"gemini_batch_overlap" json:"gemini_batch_overlap"`     // Trailing words of the previous batch resent as context with the next
+	MinBatchCoverage        float64           `yaml:"min_batch_coverage" json:"min_batch_coverage"`         // Minimum fraction of a batch a response must cover before it is retried
+	RetryInvalidBatches     bool              `yaml:"retry_invalid_batches" json:"retry_invalid_batches"`   // Request a batch once more if its word indices are invalid
+	ModelTimings            bool              `yaml:"model_timings" json:"model_timings"`                   // Use the block timings the model copies instead of looking them up by st_id
+	OpenAIAPIKey            string            `yaml:"openai_api_key" json:"openai_api_key"`
+	OpenAIModel             string            `yaml:"openai_model" json:"openai_model"`
+	OpenAIBaseURL           string            `yaml:"openai_base_url" json:"openai_base_url"` // Base URL of an OpenAI-compatible API, including the version path
+	OllamaModel             string            `yaml:"ollama_model" json:"ollama_model"`
+	OllamaBaseURL           string            `yaml:"ollama_base_url" json:"ollama_base_url"`
+	PromptPricePer1K        float64           `yaml:"gemini_prompt_price_per_1k" json:"gemini_prompt_price_per_1k"` // Price per 1K prompt tokens, used for cost estimates
+	OutputPricePer1K        float64           `yaml:"gemini_output_price_per_1k" json:"gemini_output_price_per_1k"` // Price per 1K output tokens, used for cost estimates
+	DebugMode               bool              `env:"DEBUG_MODE" envDefault:"false" yaml:"-" json:"-"`
+	DebugDir                string            `env:"DEBUG_DIR" envDefault:"debug" yaml:"-" json:"-"`
+	SilenceGapMs            int               `yaml:"silence_gap_ms" json:"silence_gap_ms"`                   // Insert placeholder cues in gaps longer than this (0 disables)
+	SilenceMarker           string            `yaml:"silence_marker" json:"silence_marker"`                   // Text of the placeholder cues (may be empty)
+	YtdlpVersion            string            `yaml:"ytdlp_version" json:"ytdlp_version"`                     // Required yt-dlp version (empty accepts the bundled default)
+	SubtitleLanguages       []string          `yaml:"sub_langs" json:"sub_langs"`                             // Languages of the auto-generated subtitles to download and refine
+	FallbackLanguages       []string          `yaml:"sub_langs_fallback" json:"sub_langs_fallback"`           // Languages to download instead when the video has none of SubtitleLanguages
+	LastWordPadMs           int               `yaml:"-" json:"-"`                                             // Display time added after the last word's start
+	MinBlockDurationMs      int               `yaml:"min_block_duration_ms" json:"min_block_duration_ms"`     // Minimum display time of a refined block
+	SubtitleGapMs           int               `yaml:"subtitle_gap_ms" json:"subtitle_gap_ms"`                 // Minimum gap kept between consecutive subtitles
+	LastWordCharMs          float64           `yaml:"last_word_char_ms" json:"last_word_char_ms"`             // Extra display time per character of the last word
+	SplitChapters           bool              `yaml:"split_chapters" json:"split_chapters"`                   // Also write one subtitle file per video chapter
+	ChapterBatching         bool              `yaml:"chapter_batching" json:"chapter_batching"`               // End batches at video chapter starts so they don't cross chapters
+	SavePartial             bool              `yaml:"save_partial" json:"save_partial"`                       // Write the subtitles of the batches done to a .partial file when a run fails
+	Numbering               string            `yaml:"subtitle_numbering" json:"subtitle_numbering"`           // Cue numbering of chapter files: "global" or "per-file"
+	WordSplit               string            `yaml:"word_split" json:"word_split"`                           // Splitting of multi-word caption segments: "none" or "space"
+	MaxWordsPerSecond       float64           `yaml:"max_wps" json:"max_wps"`                                 // Flag blocks spoken faster than this as mis-timed (0 disables)
+	MaxCPS                  float64           `yaml:"max_cps" json:"max_cps"`                                 // Extend blocks read faster than this many characters per second (0 disables)
+	MaxCPSThai              float64           `yaml:"max_cps_thai" json:"max_cps_thai"`                       // Characters-per-second limit for Thai blocks (0 disables)
+	MaxLineLength           int               `yaml:"max_line_length" json:"max_line_length"`                 // Wrap subtitle text at this many characters per line (0 disables)
+	MaxLines                int               `yaml:"max_lines" json:"max_lines"`                             // Maximum number of lines per subtitle when wrapping
+	Strict                  bool              `yaml:"strict" json:"strict"`                                   // Fail instead of warning when quality checks flag blocks
+	VerifyWords             bool              `yaml:"verify_words" json:"verify_words"`                       // Flag blocks whose text has words that aren't in the source captions
+	LowConfidence           float64           `yaml:"low_confidence" json:"low_confidence"`                   // Mark source words recognized with less confidence than this, from 0 to 1 (0 disables)
+	OutputFormat            string            `yaml:"output_format" json:"output_format"`                     // Serialization format of the output file
+	OutputFormats           []string          `yaml:"output_formats" json:"output_formats"`                   // Formats written side by side, each named after the output with its own extension (empty writes OutputFormat only)
+	OutputExt               string            `yaml:"output_ext" json:"output_ext"`                           // Extension of the output file (defaults to the format)
+	OutputPattern           string            `yaml:"output_pattern" json:"output_pattern"`                   // Output path pattern of convert_srt with {dir}, {name}, {ext} and {lang} tokens
+	KeepFormatting          bool              `yaml:"keep_formatting" json:"keep_formatting"`                 // Carry bold, italic and underline from srv3 pens into <b>, <i> and <u> tags
+	RTLMarkers              bool              `yaml:"rtl_markers" json:"rtl_markers"`                         // Wrap right-to-left lines in Unicode directional embedding marks
+	ShiftMs                 int               `yaml:"shift_ms" json:"shift_ms"`                               // Move all subtitles by this much, earlier if negative
+	ScaleFactor             float64           `yaml:"-" json:"-"`                                             // Stretch all timings by this factor (1 disables)
+	ScaleAnchorMs           int               `yaml:"-" json:"-"`                                             // Time that stays fixed when scaling
+	ClipSinceMs             int               `yaml:"-" json:"-"`                                             // Only keep subtitles after this time
+	ClipUntilMs             int               `yaml:"-" json:"-"`                                             // Only keep subtitles before this time (0 disables)
+	ClipRebase              bool              `yaml:"clip_rebase" json:"clip_rebase"`                         // Move clipped subtitles so the clip starts at zero
+	RedactPII               bool              `yaml:"redact_pii" json:"redact_pii"`                           // Redact sensitive text before sending it to the API
+	RedactPatternsFile      string            `yaml:"redact_patterns_file" json:"redact_patterns_file"`       // File of redaction regexes, one per line (default: emails and phone numbers)
+	OutputDir               string            `yaml:"output_dir" json:"output_dir"`                           // Directory videos are downloaded to and their subtitles written to
+	DownloadCacheDir        string            `yaml:"download_cache_dir" json:"download_cache_dir"`           // Directory caching downloads by video ID (empty disables)
+	CacheVideo              bool              `yaml:"cache_video" json:"cache_video"`                         // Also cache the downloaded video, not just the subtitles
+	RecodeVideo             bool              `yaml:"recode_video" json:"recode_video"`                       // Re-encode the downloaded video into VideoContainer instead of remuxing it
+	KeepSrv3                bool              `yaml:"keep_srv3" json:"keep_srv3"`                             // Keep the downloaded srv3 files after their subtitles are written
+	KeepVideo               bool              `yaml:"keep_video" json:"keep_video"`                           // Keep the downloaded video after the subtitles are written
+	VideoContainer          string            `yaml:"video_container" json:"video_container"`                 // Container of the downloaded video, e.g. mp4 or mkv (empty keeps the source container)
+	FormatSort              string            `yaml:"format_sort" json:"format_sort"`                         // yt-dlp format sort order used to pick the download format
+	CookiesFile             string            `yaml:"cookies_file" json:"cookies_file"`                       // Netscape cookies file passed to yt-dlp for restricted videos
+	CookiesFromBrowser      string            `yaml:"cookies_from_browser" json:"cookies_from_browser"`       // Browser yt-dlp reads cookies from, e.g. chrome or firefox:profile
+	RefreshCache            bool              `yaml:"-" json:"-"`                                             // Download again even if a cached copy exists
+	NormalizePunctuation    bool              `yaml:"normalize_punctuation" json:"normalize_punctuation"`     // Normalize sentence-ending punctuation across cues
+	MergeDuplicatesGapMs    int               `yaml:"merge_duplicates_gap_ms" json:"merge_duplicates_gap_ms"` // Merge consecutive identical blocks separated by less than this (0 disables)
+	MaxBlockDurationMs      int               `yaml:"max_block_duration_ms" json:"max_block_duration_ms"`     // Split blocks shown longer than this (0 disables)
+	RawMaxWords             int               `yaml:"raw_max_words" json:"raw_max_words"`                     // Maximum words per block in raw mode (0 disables)
+	RawMinBlockMs           int               `yaml:"raw_min_block_ms" json:"raw_min_block_ms"`               // Minimum display time of a block in raw mode
+	RawPauseMs              int               `yaml:"raw_pause_ms" json:"raw_pause_ms"`                       // Start a new block after a pause this long in raw mode (0 disables)
+	TranslateTo             string            `yaml:"translate_to" json:"translate_to"`                       // Also write a translation into this language (empty disables)
+	TranslateOnly           bool              `yaml:"translate_only" json:"translate_only"`                   // Write only the translation, not the refined original
+	Bilingual               bool              `yaml:"bilingual" json:"bilingual"`                             // Write the translation as two-line cues with the original on the first line
+	LogLevel                string            `yaml:"log_level" json:"log_level"`                             // Minimum log level: debug, info, warn or error (default: debug in debug mode, else info)
+	LogFormat               string            `yaml:"log_format" json:"log_format"`                           // Log output format: text or json
 }
 
+// proxySchemes are the proxy URL schemes supported by Go's HTTP transport
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+// apiVersionPattern matches Gemini API version paths such as v1, v1beta or v1alpha
+var apiVersionPattern = regexp.MustCompile(`^v\d+(alpha|beta)?\d*$`)
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		return nil, errors.New("GEMINI_API_KEY environment variable not set")
+	return loadEnv(defaultConfig())
+}
+
+// defaultConfig returns the configuration used where nothing else is set
+func defaultConfig() *Config {
+	return &Config{
+		LLMProvider:         "gemini",
+		GeminiModel:         "gemini-1.5-flash",
+		GeminiBaseURL:       "https://generativelanguage.googleapis.com",
+		GeminiAPIVersion:    "v1beta",
+		GeminiTemperature:   0.3,
+		GeminiMaxTokens:     8192,
+		GeminiConcurrency:   1,
+		OpenAIModel:         "gpt-4o-mini",
+		OpenAIBaseURL:       "https://api.openai.com/v1",
+		OllamaModel:         "llama3.1",
+		OllamaBaseURL:       "http://localhost:11434",
+		MinBatchCoverage:    0.5,
+		RetryInvalidBatches: true,
+		LastWordPadMs:       1500,
+		MinBlockDurationMs:  1000,
+		SubtitleGapMs:       100,
+		Numbering:           "global",
+		WordSplit:           "none",
+		MaxWordsPerSecond:   10,
+		MaxCPS:              17,
+		MaxCPSThai:          20,
+		MaxLineLength:       0,
+		MaxLines:            2,
+		ScaleFactor:         1,
+		RawMaxWords:         12,
+		RawMinBlockMs:       1000,
+		RawPauseMs:          1000,
+		OutputFormat:        "srt",
+		OutputDir:           "output",
+		DownloadCacheDir:    "cache",
+		SubtitleLanguages:   []string{"th"},
+		RecodeVideo:         true,
+		KeepSrv3:            true,
+		KeepVideo:           true,
+		VideoContainer:      "mp4",
+		FormatSort:          "res,ext:mp4:m4a",
+		LogFormat:           "text",
+	}
+}
+
+// loadEnv overrides cfg with the environment variables that are set and validates
+// the result
+func loadEnv(cfg *Config) (*Config, error) {
+	// Collect malformed values rather than stopping at the first
+	var errs []error
+	if envProvider := os.Getenv("LLM_PROVIDER"); envProvider != "" {
+		cfg.LLMProvider = strings.ToLower(envProvider)
+	}
+
+	switch cfg.LLMProvider {
+	case "gemini", "openai", "ollama":
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q (supported: gemini, openai, ollama)", cfg.LLMProvider)
+	}
+
+	if envKey := os.Getenv("GEMINI_API_KEY"); envKey != "" {
+		cfg.GeminiAPIKey = envKey
 	}
 
-	// Default parameters
-	cfg := &Config{
-		GeminiAPIKey:      apiKey,
-		GeminiModel:       "gemini-1.5-flash",
-		GeminiTemperature: 0.3,
-		GeminiMaxTokens:   8192,
+	if envKey := os.Getenv("OPENAI_API_KEY"); envKey != "" {
+		cfg.OpenAIAPIKey = envKey
+	}
+
+	if envModel := os.Getenv("OPENAI_MODEL"); envModel != "" {
+		cfg.OpenAIModel = envModel
+	}
+
+	if envBaseURL := os.Getenv("OPENAI_BASE_URL"); envBaseURL != "" {
+		cfg.OpenAIBaseURL = envBaseURL
+	}
+
+	if envModel := os.Getenv("OLLAMA_MODEL"); envModel != "" {
+		cfg.OllamaModel = envModel
+	}
+
+	if envBaseURL := os.Getenv("OLLAMA_BASE_URL"); envBaseURL != "" {
+		cfg.OllamaBaseURL = envBaseURL
 	}
 
-	// Override with environment variables if set
 	if envModel := os.Getenv("GEMINI_MODEL"); envModel != "" {
-		cfg.GeminiModel = envModel
+		cfg.GeminiModel = ResolveGeminiModel(envModel)
+	}
+
+	if envBaseURL := os.Getenv("GEMINI_BASE_URL"); envBaseURL != "" {
+		cfg.GeminiBaseURL = envBaseURL
 	}
 
-	if envTemp := os.Getenv("GEMINI_TEMPERATURE"); envTemp != "" {
-		if t, err := strconv.ParseFloat(envTemp, 64); err == nil {
-			cfg.GeminiTemperature = t
+	if envProxy := os.Getenv("GEMINI_PROXY"); envProxy != "" {
+		cfg.GeminiProxy = envProxy
+	}
+
+	if envSafety := os.Getenv("GEMINI_SAFETY"); envSafety != "" {
+		safety, err := ParseSafety(envSafety)
+		errs = append(errs, err)
+		cfg.GeminiSafety = safety
+	}
+
+	if envPromptFile := os.Getenv("GEMINI_PROMPT_FILE"); envPromptFile != "" {
+		cfg.GeminiPromptFile = envPromptFile
+	}
+
+	if envHint := os.Getenv("LANGUAGE_HINT"); envHint != "" {
+		cfg.LanguageHint = envHint
+	}
+
+	if envCacheDir := os.Getenv("GEMINI_CACHE_DIR"); envCacheDir != "" {
+		cfg.GeminiCacheDir = envCacheDir
+	}
+
+	if envVersion := os.Getenv("GEMINI_API_VERSION"); envVersion != "" {
+		cfg.GeminiAPIVersion = envVersion
+	}
+
+	errs = append(errs, envFloat("GEMINI_TEMPERATURE", &cfg.GeminiTemperature))
+	errs = append(errs, envBool("DETERMINISTIC", &cfg.Deterministic))
+	errs = append(errs, envInt("GEMINI_MAX_TOKENS", &cfg.GeminiMaxTokens))
+	errs = append(errs, envInt("GEMINI_RPM", &cfg.GeminiRequestsPerMinute))
+	errs = append(errs, envInt("GEMINI_REQUEST_TIMEOUT", &cfg.GeminiRequestTimeout))
+	errs = append(errs, envInt("GEMINI_CONCURRENCY", &cfg.GeminiConcurrency))
+	errs = append(errs, envInt("GEMINI_BATCH_SIZE", &cfg.GeminiBatchSize))
+	errs = append(errs, envInt("GEMINI_BATCH_OVERLAP", &cfg.GeminiBatchOverlap))
+	errs = append(errs, envFloat("MIN_BATCH_COVERAGE", &cfg.MinBatchCoverage))
+	errs = append(errs, envBool("RETRY_INVALID_BATCHES", &cfg.RetryInvalidBatches))
+	errs = append(errs, envBool("MODEL_TIMINGS", &cfg.ModelTimings))
+	errs = append(errs, envFloat("GEMINI_PROMPT_PRICE_PER_1K", &cfg.PromptPricePer1K))
+	errs = append(errs, envFloat("GEMINI_OUTPUT_PRICE_PER_1K", &cfg.OutputPricePer1K))
+	errs = append(errs, envInt("SILENCE_GAP_MS", &cfg.SilenceGapMs))
+
+	if envMarker, ok := os.LookupEnv("SILENCE_MARKER"); ok {
+		cfg.SilenceMarker = envMarker
+	}
+
+	if envYtdlpVersion := os.Getenv("YTDLP_VERSION"); envYtdlpVersion != "" {
+		cfg.YtdlpVersion = envYtdlpVersion
+	}
+
+	errs = append(errs, envBool("SPLIT_CHAPTERS", &cfg.SplitChapters))
+	errs = append(errs, envBool("CHAPTER_BATCHING", &cfg.ChapterBatching))
+	errs = append(errs, envBool("SAVE_PARTIAL", &cfg.SavePartial))
+
+	if envLangs := os.Getenv("SUB_LANGS"); envLangs != "" {
+		if langs := ParseLanguages(envLangs); len(langs) > 0 {
+			cfg.SubtitleLanguages = langs
 		}
 	}
 
-	if envMaxTokens := os.Getenv("GEMINI_MAX_TOKENS"); envMaxTokens != "" {
-		if mt, err := strconv.Atoi(envMaxTokens); err == nil {
-			cfg.GeminiMaxTokens = mt
+	if envLangs := os.Getenv("SUB_LANGS_FALLBACK"); envLangs != "" {
+		cfg.FallbackLanguages = ParseLanguages(envLangs)
+	}
+
+	if envNumbering := os.Getenv("SUBTITLE_NUMBERING"); envNumbering != "" {
+		cfg.Numbering = envNumbering
+	}
+
+	if envWordSplit := os.Getenv("WORD_SPLIT"); envWordSplit != "" {
+		cfg.WordSplit = envWordSplit
+	}
+
+	errs = append(errs, envFloat("MAX_WPS", &cfg.MaxWordsPerSecond))
+	errs = append(errs, envFloat("MAX_CPS", &cfg.MaxCPS))
+	errs = append(errs, envFloat("MAX_CPS_THAI", &cfg.MaxCPSThai))
+	errs = append(errs, envInt("MAX_LINE_LENGTH", &cfg.MaxLineLength))
+	errs = append(errs, envInt("MAX_LINES", &cfg.MaxLines))
+	errs = append(errs, envBool("STRICT", &cfg.Strict))
+	errs = append(errs, envBool("VERIFY_WORDS", &cfg.VerifyWords))
+	errs = append(errs, envFloat("LOW_CONFIDENCE", &cfg.LowConfidence))
+
+	if envFormat := os.Getenv("OUTPUT_FORMAT"); envFormat != "" {
+		cfg.OutputFormat = envFormat
+	}
+
+	if envFormats := os.Getenv("OUTPUT_FORMATS"); envFormats != "" {
+		cfg.OutputFormats = ParseLanguages(envFormats)
+		if len(cfg.OutputFormats) > 0 {
+			cfg.OutputFormat = cfg.OutputFormats[0]
+		}
+	}
+
+	if envExt := os.Getenv("OUTPUT_EXT"); envExt != "" {
+		cfg.OutputExt = envExt
+	}
+
+	if envPattern := os.Getenv("OUTPUT_PATTERN"); envPattern != "" {
+		cfg.OutputPattern = envPattern
+	}
+
+	errs = append(errs, envBool("KEEP_FORMATTING", &cfg.KeepFormatting))
+	errs = append(errs, envBool("RTL_MARKERS", &cfg.RTLMarkers))
+	errs = append(errs, envInt("SHIFT_MS", &cfg.ShiftMs))
+	if envScale := os.Getenv("SCALE"); envScale != "" {
+		factor, err := ParseScale(envScale)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SCALE: %w", err))
 		}
+		cfg.ScaleFactor = factor
+	}
+	errs = append(errs, envTimestamp("SCALE_ANCHOR", &cfg.ScaleAnchorMs))
+	errs = append(errs, envTimestamp("CLIP_SINCE", &cfg.ClipSinceMs))
+	errs = append(errs, envTimestamp("CLIP_UNTIL", &cfg.ClipUntilMs))
+	errs = append(errs, envBool("CLIP_REBASE", &cfg.ClipRebase))
+
+	errs = append(errs, envBool("REDACT_PII", &cfg.RedactPII))
+
+	if envPatterns := os.Getenv("REDACT_PATTERNS_FILE"); envPatterns != "" {
+		cfg.RedactPatternsFile = envPatterns
+	}
+
+	if envOutputDir := os.Getenv("OUTPUT_DIR"); envOutputDir != "" {
+		cfg.OutputDir = envOutputDir
+	}
+
+	if envCacheDir, ok := os.LookupEnv("DOWNLOAD_CACHE_DIR"); ok {
+		cfg.DownloadCacheDir = envCacheDir
+	}
+
+	errs = append(errs, envBool("CACHE_VIDEO", &cfg.CacheVideo))
+	errs = append(errs, envBool("RECODE_VIDEO", &cfg.RecodeVideo))
+	errs = append(errs, envBool("KEEP_SRV3", &cfg.KeepSrv3))
+	errs = append(errs, envBool("KEEP_VIDEO", &cfg.KeepVideo))
+
+	if envContainer, ok := os.LookupEnv("VIDEO_CONTAINER"); ok {
+		cfg.VideoContainer = envContainer
+	}
+
+	if envFormatSort := os.Getenv("FORMAT_SORT"); envFormatSort != "" {
+		cfg.FormatSort = envFormatSort
+	}
+
+	if envCookies := os.Getenv("COOKIES_FILE"); envCookies != "" {
+		cfg.CookiesFile = envCookies
+	}
+
+	if envBrowser := os.Getenv("COOKIES_FROM_BROWSER"); envBrowser != "" {
+		cfg.CookiesFromBrowser = envBrowser
 	}
 
+	errs = append(errs, envBool("NORMALIZE_PUNCTUATION", &cfg.NormalizePunctuation))
+
+	if envLang := os.Getenv("TRANSLATE_TO"); envLang != "" {
+		cfg.TranslateTo = envLang
+	}
+	errs = append(errs, envBool("TRANSLATE_ONLY", &cfg.TranslateOnly))
+	errs = append(errs, envBool("BILINGUAL", &cfg.Bilingual))
+	errs = append(errs, envInt("MERGE_DUPLICATES_GAP_MS", &cfg.MergeDuplicatesGapMs))
+	errs = append(errs, envInt("MAX_BLOCK_DURATION_MS", &cfg.MaxBlockDurationMs))
+	errs = append(errs, envInt("RAW_MAX_WORDS", &cfg.RawMaxWords))
+	errs = append(errs, envInt("RAW_MIN_BLOCK_MS", &cfg.RawMinBlockMs))
+	errs = append(errs, envInt("RAW_PAUSE_MS", &cfg.RawPauseMs))
+	errs = append(errs, envInt("LAST_WORD_DURATION_MS", &cfg.LastWordPadMs))
+	errs = append(errs, envInt("LAST_WORD_PAD_MS", &cfg.LastWordPadMs))
+	errs = append(errs, envInt("MIN_BLOCK_DURATION_MS", &cfg.MinBlockDurationMs))
+	errs = append(errs, envInt("SUBTITLE_GAP_MS", &cfg.SubtitleGapMs))
+	errs = append(errs, envFloat("LAST_WORD_CHAR_MS", &cfg.LastWordCharMs))
+
+	if envLevel := os.Getenv("LOG_LEVEL"); envLevel != "" {
+		cfg.LogLevel = envLevel
+	}
+	if envLogFormat := os.Getenv("LOG_FORMAT"); envLogFormat != "" {
+		cfg.LogFormat = envLogFormat
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+// Validate checks that the configuration values are in range, so a typo fails at
+// startup instead of silently running with odd settings
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if c.LLMProvider == "gemini" {
+		if err := checkGeminiModel(c.GeminiModel); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	check(apiVersionPattern.MatchString(strings.Trim(c.GeminiAPIVersion, "/")),
+		"invalid GEMINI_API_VERSION %q: must be like v1 or v1beta", c.GeminiAPIVersion)
+	check(c.GeminiTemperature >= 0 && c.GeminiTemperature <= 2,
+		"GEMINI_TEMPERATURE must be between 0 and 2, got %g", c.GeminiTemperature)
+	check(c.GeminiMaxTokens > 0, "GEMINI_MAX_TOKENS must be positive, got %d", c.GeminiMaxTokens)
+	check(c.GeminiRequestsPerMinute >= 0, "GEMINI_RPM can't be negative, got %d", c.GeminiRequestsPerMinute)
+	check(c.GeminiRequestTimeout >= 0, "GEMINI_REQUEST_TIMEOUT can't be negative, got %d", c.GeminiRequestTimeout)
+	if c.GeminiProxy != "" {
+		proxy, err := url.Parse(c.GeminiProxy)
+		check(err == nil && proxy.Host != "" && proxySchemes[proxy.Scheme],
+			"invalid GEMINI_PROXY %q: must be an http, https or socks5 URL like socks5://host:1080", c.GeminiProxy)
+	}
+	check(c.GeminiConcurrency > 0, "GEMINI_CONCURRENCY must be positive, got %d", c.GeminiConcurrency)
+	check(c.GeminiBatchSize >= 0, "GEMINI_BATCH_SIZE can't be negative, got %d", c.GeminiBatchSize)
+	check(c.GeminiBatchOverlap >= 0, "GEMINI_BATCH_OVERLAP can't be negative, got %d", c.GeminiBatchOverlap)
+	check(c.GeminiBatchSize == 0 || c.GeminiBatchOverlap < c.GeminiBatchSize,
+		"GEMINI_BATCH_OVERLAP (%d) must be smaller than GEMINI_BATCH_SIZE (%d)", c.GeminiBatchOverlap, c.GeminiBatchSize)
+	check(c.MinBatchCoverage >= 0 && c.MinBatchCoverage <= 1,
+		"MIN_BATCH_COVERAGE must be between 0 and 1, got %g", c.MinBatchCoverage)
+	check(c.PromptPricePer1K >= 0 && c.OutputPricePer1K >= 0, "token prices can't be negative")
+	check(c.LastWordPadMs >= 0, "LAST_WORD_PAD_MS can't be negative, got %d", c.LastWordPadMs)
+	check(c.LastWordCharMs >= 0, "LAST_WORD_CHAR_MS can't be negative, got %g", c.LastWordCharMs)
+	check(c.MinBlockDurationMs >= 0, "MIN_BLOCK_DURATION_MS can't be negative, got %d", c.MinBlockDurationMs)
+	check(c.SubtitleGapMs >= 0, "SUBTITLE_GAP_MS can't be negative, got %d", c.SubtitleGapMs)
+	check(c.SilenceGapMs >= 0, "SILENCE_GAP_MS can't be negative, got %d", c.SilenceGapMs)
+	check(c.MergeDuplicatesGapMs >= 0, "MERGE_DUPLICATES_GAP_MS can't be negative, got %d", c.MergeDuplicatesGapMs)
+	check(c.MaxBlockDurationMs >= 0, "MAX_BLOCK_DURATION_MS can't be negative, got %d", c.MaxBlockDurationMs)
+	check(c.RawMaxWords >= 0 && c.RawMinBlockMs >= 0 && c.RawPauseMs >= 0,
+		"RAW_MAX_WORDS, RAW_MIN_BLOCK_MS and RAW_PAUSE_MS can't be negative")
+	check(c.MaxWordsPerSecond >= 0, "MAX_WPS can't be negative, got %g", c.MaxWordsPerSecond)
+	check(c.MaxCPS >= 0 && c.MaxCPSThai >= 0, "MAX_CPS and MAX_CPS_THAI can't be negative")
+	check(c.LowConfidence >= 0 && c.LowConfidence <= 1,
+		"LOW_CONFIDENCE must be between 0 and 1, got %g", c.LowConfidence)
+	check(c.MaxLineLength >= 0, "MAX_LINE_LENGTH can't be negative, got %d", c.MaxLineLength)
+	check(c.MaxLines > 0, "MAX_LINES must be positive, got %d", c.MaxLines)
+	check(c.Numbering == "global" || c.Numbering == "per-file",
+		"invalid numbering %q: must be global or per-file", c.Numbering)
+	check(c.WordSplit == "none" || c.WordSplit == "space",
+		"invalid WORD_SPLIT %q: must be none or space", c.WordSplit)
+	check(c.ScaleFactor > 0, "SCALE must be positive, got %g", c.ScaleFactor)
+	check(c.ClipSinceMs >= 0 && c.ClipUntilMs >= 0, "CLIP_SINCE and CLIP_UNTIL can't be negative")
+	check(c.ClipUntilMs == 0 || c.ClipUntilMs > c.ClipSinceMs,
+		"CLIP_UNTIL (%dms) must be after CLIP_SINCE (%dms)", c.ClipUntilMs, c.ClipSinceMs)
+	check(!c.ClipRebase || !c.SplitChapters, "CLIP_REBASE can't be used with SPLIT_CHAPTERS")
+
+	return errors.Join(errs...)
+}
+
+// envTimestamp sets *dst in milliseconds from the time environment variable name,
+// if it is set
+func envTimestamp(name string, dst *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	ms, err := ParseTimestamp(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = ms
+	return nil
+}
+
+// envInt sets *dst from the integer environment variable name, if it is set
+func envInt(name string, dst *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: expected a whole number", name, value)
+	}
+	*dst = n
+	return nil
+}
+
+// envFloat sets *dst from the numeric environment variable name, if it is set
+func envFloat(name string, dst *float64) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: expected a number", name, value)
+	}
+	*dst = f
+	return nil
+}
+
+// envBool sets *dst from the boolean environment variable name, if it is set
+func envBool(name string, dst *bool) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: expected true or false", name, value)
+	}
+	*dst = b
+	return nil
+}
+
+// ParseTimestamp parses a time given as HH:MM:SS or MM:SS, optionally with a
+// fraction such as 01:02:03.5, or as plain seconds such as 90 or 12.5, and returns
+// it in milliseconds
+func ParseTimestamp(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM:SS or seconds", value)
+	}
+
+	var seconds float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || (i < len(parts)-1 && n != math.Trunc(n)) {
+			return 0, fmt.Errorf("invalid time %q: expected HH:MM:SS or seconds", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return int(math.Round(seconds * 1000)), nil
+}
+
+// ParseScale parses a timing scale factor given as a number such as 1.0427 or as
+// a ratio such as 25/23.976
+func ParseScale(value string) (float64, error) {
+	num, den, isRatio := strings.Cut(strings.TrimSpace(value), "/")
+	factor, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err == nil && isRatio {
+		var d float64
+		d, err = strconv.ParseFloat(strings.TrimSpace(den), 64)
+		if err == nil && d == 0 {
+			err = errors.New("division by zero")
+		}
+		factor /= d
+	}
+	if err != nil || factor <= 0 {
+		return 0, fmt.Errorf("invalid scale %q: expected a positive number or ratio such as 25/23.976", value)
+	}
+	return factor, nil
+}
+
+// ParseLanguages splits a comma-separated language list such as "th,en", dropping
+// blanks and duplicates
+func ParseLanguages(list string) []string {
+	var langs []string
+	seen := make(map[string]bool)
+	for _, lang := range strings.Split(list, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang == "" || seen[lang] {
+			continue
+		}
+		seen[lang] = true
+		langs = append(langs, lang)
+	}
+	return langs
+}
+
+// EffectiveLogLevel returns the configured log level, defaulting to debug in debug
+// mode and info otherwise
+func (c *Config) EffectiveLogLevel() string {
+	if c.LogLevel != "" {
+		return c.LogLevel
+	}
+	if c.DebugMode {
+		return "debug"
+	}
+	return "info"
+}
+
+// DeterministicSeed is the sampling seed sent to providers that accept one in
+// deterministic mode
+const DeterministicSeed = 1
+
+// Temperature returns the sampling temperature sent to the model: 0 in
+// deterministic mode, and GeminiTemperature otherwise
+func (c *Config) Temperature() float64 {
+	if c.Deterministic {
+		return 0
+	}
+	return c.GeminiTemperature
+}
+
+// CheckAPIKey returns an error if the selected provider's API key isn't set. Only
+// that provider's key is required, and Ollama needs none. Runs that never call the
+// API, such as raw conversions, can skip the check.
+func (c *Config) CheckAPIKey() error {
+	switch c.LLMProvider {
+	case "gemini":
+		if c.GeminiAPIKey == "" {
+			return errors.New("GEMINI_API_KEY environment variable not set")
+		}
+	case "openai":
+		if c.OpenAIAPIKey == "" {
+			return errors.New("OPENAI_API_KEY environment variable not set")
+		}
+	}
+	return nil
+}
+
+// OutputExtension returns the output file extension, without a leading dot. It is
+// OutputExt when set and otherwise matches OutputFormat.
+func (c *Config) OutputExtension() string {
+	if c.OutputExt != "" {
+		return strings.TrimPrefix(c.OutputExt, ".")
+	}
+	return c.OutputFormat
+}
+
 // LoadEnvFile loads environment variables from a .env file
 func LoadEnvFile(filename string) error {
 	data, err := os.ReadFile(filename)
@@ -63,28 +627,12 @@ func LoadEnvFile(filename string) error {
 		return err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		// Skip comments and empty lines
-		line = strings.TrimSpace(line)
-		if len(line) == 0 || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Split by the first equals sign
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := parseEnvLine(line)
+		if !ok {
 			continue
 		}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-
-		// Remove quotes if present
-		if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[0] == value[len(value)-1] {
-			value = value[1 : len(value)-1]
-		}
-
 		// Set environment variable if it's not already set
 		if os.Getenv(key) == "" {
 			os.Setenv(key, value)
@@ -93,3 +641,39 @@ func LoadEnvFile(filename string) error {
 
 	return nil
 }
+
+// parseEnvLine parses a KEY=value line of a .env file. It accepts an optional
+// "export " prefix and CRLF line endings. Quoted values are taken verbatim up to the
+// closing quote, while unquoted values end at an inline " # comment". Blank lines
+// and comments return ok false.
+func parseEnvLine(line string) (key, value string, ok bool) {
+	line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+	// Split by the first equals sign; the value may contain more
+	key, value, found := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return "", "", false
+	}
+	value = strings.TrimSpace(value)
+
+	// Quoted values keep everything up to the closing quote, including any #
+	if len(value) > 1 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return key, value[1 : end+1], true
+		}
+	}
+
+	// Drop an inline comment, which must be preceded by whitespace
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			value = strings.TrimSpace(value[:i])
+			break
+		}
+	}
+	return key, value, true
+}
@@ -0,0 +1,69 @@
+package config
+
+import "testing"
+
+func TestParseEnvLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantKey   string
+		wantValue string
+		wantOK    bool
+	}{
+		{name: "plain", line: "GEMINI_MODEL=gemini-pro", wantKey: "GEMINI_MODEL", wantValue: "gemini-pro", wantOK: true},
+		{name: "export prefix", line: "export GEMINI_MODEL=gemini-pro", wantKey: "GEMINI_MODEL", wantValue: "gemini-pro", wantOK: true},
+		{name: "CRLF", line: "GEMINI_MODEL=gemini-pro\r", wantKey: "GEMINI_MODEL", wantValue: "gemini-pro", wantOK: true},
+		{name: "export and CRLF", line: "export KEY='a b'\r", wantKey: "KEY", wantValue: "a b", wantOK: true},
+		{name: "spaces around equals", line: "  KEY = value  ", wantKey: "KEY", wantValue: "value", wantOK: true},
+		{name: "value with equals", line: "KEY=a=b", wantKey: "KEY", wantValue: "a=b", wantOK: true},
+		{name: "double quoted with hash", line: `KEY="abc # def"`, wantKey: "KEY", wantValue: "abc # def", wantOK: true},
+		{name: "single quoted with hash", line: "KEY='abc#def' # note", wantKey: "KEY", wantValue: "abc#def", wantOK: true},
+		{name: "inline comment", line: "KEY=value # note", wantKey: "KEY", wantValue: "value", wantOK: true},
+		{name: "inline comment after tab", line: "KEY=value\t# note", wantKey: "KEY", wantValue: "value", wantOK: true},
+		{name: "hash inside value", line: "KEY=abc#def", wantKey: "KEY", wantValue: "abc#def", wantOK: true},
+		{name: "unclosed quote", line: `KEY="abc`, wantKey: "KEY", wantValue: `"abc`, wantOK: true},
+		{name: "empty value", line: "KEY=", wantKey: "KEY", wantValue: "", wantOK: true},
+		{name: "blank", line: "   \r", wantOK: false},
+		{name: "comment", line: "# KEY=value", wantOK: false},
+		{name: "no equals", line: "KEY", wantOK: false},
+		{name: "no key", line: "=value", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, value, ok := parseEnvLine(tt.line)
+			if key != tt.wantKey || value != tt.wantValue || ok != tt.wantOK {
+				t.Errorf("parseEnvLine(%q) = %q, %q, %v; want %q, %q, %v",
+					tt.line, key, value, ok, tt.wantKey, tt.wantValue, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadReadabilityDefaults(t *testing.T) {
+	t.Setenv("MAX_CPS", "")
+	t.Setenv("MAX_LINE_LENGTH", "")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MaxCPS != 17 || cfg.MaxCPSThai != 20 {
+		t.Errorf("MaxCPS = %g, MaxCPSThai = %g by default, want 17 and 20", cfg.MaxCPS, cfg.MaxCPSThai)
+	}
+	if cfg.MaxLineLength != 0 {
+		t.Errorf("MaxLineLength = %d by default, want 0 (disabled)", cfg.MaxLineLength)
+	}
+
+	t.Setenv("MAX_CPS", "0")
+	t.Setenv("MAX_LINE_LENGTH", "42")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MaxCPS != 0 {
+		t.Errorf("MaxCPS = %g with MAX_CPS=0, want 0 (disabled)", cfg.MaxCPS)
+	}
+	if cfg.MaxLineLength != 42 {
+		t.Errorf("MaxLineLength = %d with MAX_LINE_LENGTH=42, want 42", cfg.MaxLineLength)
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the content of a config file: the settings of Config, plus those
+// written as text that is parsed the way their environment variables are
+type fileConfig struct {
+	Config `yaml:",inline"`
+
+	GeminiSafety       any  `yaml:"gemini_safety" json:"gemini_safety"`
+	Scale              any  `yaml:"scale" json:"scale"`
+	ScaleAnchor        any  `yaml:"scale_anchor" json:"scale_anchor"`
+	ClipSince          any  `yaml:"clip_since" json:"clip_since"`
+	ClipUntil          any  `yaml:"clip_until" json:"clip_until"`
+	LastWordPadMs      *int `yaml:"last_word_pad_ms" json:"last_word_pad_ms"`
+	LastWordDurationMs *int `yaml:"last_word_duration_ms" json:"last_word_duration_ms"` // Older name of last_word_pad_ms
+}
+
+// LoadFile loads the configuration from a YAML (.yaml, .yml) or JSON (.json) file
+// whose keys are the environment variable names in lower case:
+//
+//	gemini_model: gemini-1.5-pro
+//	sub_langs: [th, en]
+//
+// Unknown keys are an error. Environment variables that are set take precedence
+// over the file, so secrets such as GEMINI_API_KEY can stay out of it.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	file := fileConfig{Config: *defaultConfig()}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&file)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&file)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (supported: .yaml, .yml, .json)", ext)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	cfg := &file.Config
+	if err := file.apply(cfg); err != nil {
+		return nil, fmt.Errorf("error in config file %s: %w", path, err)
+	}
+	return loadEnv(cfg)
+}
+
+// apply sets the settings of cfg that the file gives as text, and normalizes the
+// others as their environment variables are
+func (f *fileConfig) apply(cfg *Config) error {
+	cfg.LLMProvider = strings.ToLower(cfg.LLMProvider)
+	cfg.GeminiModel = ResolveGeminiModel(cfg.GeminiModel)
+	cfg.SubtitleLanguages = ParseLanguages(strings.Join(cfg.SubtitleLanguages, ","))
+	cfg.FallbackLanguages = ParseLanguages(strings.Join(cfg.FallbackLanguages, ","))
+	if len(cfg.OutputFormats) > 0 {
+		cfg.OutputFormats = ParseLanguages(strings.Join(cfg.OutputFormats, ","))
+		cfg.OutputFormat = cfg.OutputFormats[0]
+	}
+	if f.LastWordDurationMs != nil {
+		cfg.LastWordPadMs = *f.LastWordDurationMs
+	}
+	if f.LastWordPadMs != nil {
+		cfg.LastWordPadMs = *f.LastWordPadMs
+	}
+
+	var errs []error
+	text := func(key string, value any, set func(string) error) {
+		s, err := fileValue(value)
+		if err == nil && s != "" {
+			err = set(s)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	text("gemini_safety", f.GeminiSafety, func(s string) (err error) {
+		cfg.GeminiSafety, err = ParseSafety(s)
+		return err
+	})
+	text("scale", f.Scale, func(s string) (err error) {
+		cfg.ScaleFactor, err = ParseScale(s)
+		return err
+	})
+	text("scale_anchor", f.ScaleAnchor, func(s string) (err error) {
+		cfg.ScaleAnchorMs, err = ParseTimestamp(s)
+		return err
+	})
+	text("clip_since", f.ClipSince, func(s string) (err error) {
+		cfg.ClipSinceMs, err = ParseTimestamp(s)
+		return err
+	})
+	text("clip_until", f.ClipUntil, func(s string) (err error) {
+		cfg.ClipUntilMs, err = ParseTimestamp(s)
+		return err
+	})
+	return errors.Join(errs...)
+}
+
+// fileValue converts a config file value given as text to its environment
+// variable form. Lists become comma-separated, as in GEMINI_SAFETY.
+func fileValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", value)
+	}
+}
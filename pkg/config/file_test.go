@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes content to a config file named name in a temporary
+// directory and returns its path
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Setenv("GEMINI_MODEL", "")
+	t.Setenv("GEMINI_BATCH_SIZE", "")
+	t.Setenv("GEMINI_TEMPERATURE", "0.7")
+
+	path := writeConfigFile(t, "config.yaml", `
+gemini_model: gemini-1.5-pro
+gemini_temperature: 0.2
+gemini_batch_size: 200
+sub_langs: [th, " en "]
+last_word_pad_ms: 800
+clip_since: "1:30"
+scale: 25/24
+`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	if cfg.GeminiModel != "gemini-1.5-pro" || cfg.GeminiBatchSize != 200 || cfg.LastWordPadMs != 800 {
+		t.Errorf("got model %q, batch size %d, pad %d; want gemini-1.5-pro, 200, 800",
+			cfg.GeminiModel, cfg.GeminiBatchSize, cfg.LastWordPadMs)
+	}
+	if want := []string{"th", "en"}; !reflect.DeepEqual(cfg.SubtitleLanguages, want) {
+		t.Errorf("SubtitleLanguages = %q, want %q", cfg.SubtitleLanguages, want)
+	}
+	if cfg.ClipSinceMs != 90000 || cfg.ScaleFactor != 25.0/24 {
+		t.Errorf("got clip since %dms, scale %g; want 90000ms, %g", cfg.ClipSinceMs, cfg.ScaleFactor, 25.0/24)
+	}
+
+	// The environment wins over the file
+	if cfg.GeminiTemperature != 0.7 {
+		t.Errorf("GeminiTemperature = %g, want 0.7 from the environment", cfg.GeminiTemperature)
+	}
+
+	// Unset settings keep their defaults
+	if cfg.MaxLines != 2 {
+		t.Errorf("MaxLines = %d, want the default 2", cfg.MaxLines)
+	}
+
+	// Loading the file doesn't touch the process environment
+	if model := os.Getenv("GEMINI_MODEL"); model != "" {
+		t.Errorf("GEMINI_MODEL = %q after LoadFile, want it unset", model)
+	}
+}
+
+func TestLoadFileJSON(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"gemini_batch_size": 150, "output_formats": ["srt", "json"]}`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.GeminiBatchSize != 150 || cfg.OutputFormat != "srt" || !reflect.DeepEqual(cfg.OutputFormats, []string{"srt", "json"}) {
+		t.Errorf("got batch size %d, format %q, formats %q", cfg.GeminiBatchSize, cfg.OutputFormat, cfg.OutputFormats)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown YAML key", file: "config.yaml", content: "gemini_modle: pro\n", wantErr: "gemini_modle"},
+		{name: "unknown JSON key", file: "config.json", content: `{"gemini_modle": "pro"}`, wantErr: "gemini_modle"},
+		{name: "setting not read from a file", file: "config.yaml", content: "debug_dir: tmp\n", wantErr: "debug_dir"},
+		{name: "wrong type", file: "config.yaml", content: "gemini_batch_size: lots\n", wantErr: "lots"},
+		{name: "bad timestamp", file: "config.yaml", content: "clip_until: soon\n", wantErr: "clip_until"},
+		{name: "out of range", file: "config.json", content: `{"gemini_temperature": 5}`, wantErr: "GEMINI_TEMPERATURE"},
+		{name: "unsupported extension", file: "config.toml", content: "", wantErr: ".toml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GEMINI_TEMPERATURE", "")
+			_, err := LoadFile(writeConfigFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFile error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFileEmpty(t *testing.T) {
+	cfg, err := LoadFile(writeConfigFile(t, "config.yaml", ""))
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if want := defaultConfig(); cfg.GeminiModel != want.GeminiModel || cfg.MaxLines != want.MaxLines {
+		t.Errorf("empty file didn't give the defaults: %+v", cfg)
+	}
+}
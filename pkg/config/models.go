@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// geminiModelAliases maps the short names GEMINI_MODEL accepts to full model IDs
+var geminiModelAliases = map[string]string{
+	"flash":      "gemini-2.5-flash",
+	"flash-lite": "gemini-2.5-flash-lite",
+	"pro":        "gemini-2.5-pro",
+}
+
+// geminiModels lists the Gemini model IDs known to work with generateContent. A
+// deprecated model maps to the model to use instead; current ones map to "".
+var geminiModels = map[string]string{
+	"gemini-2.5-pro":        "",
+	"gemini-2.5-flash":      "",
+	"gemini-2.5-flash-lite": "",
+	"gemini-2.0-flash":      "",
+	"gemini-2.0-flash-lite": "",
+	"gemini-1.5-pro":        "",
+	"gemini-1.5-flash":      "",
+	"gemini-1.5-flash-8b":   "",
+	"gemini-pro":            "gemini-2.0-flash",
+	"gemini-1.0-pro":        "gemini-2.0-flash",
+	"gemini-pro-vision":     "gemini-2.0-flash",
+}
+
+// ResolveGeminiModel returns the full model ID for an alias such as flash or pro,
+// or the model itself, without any models/ prefix since the request path adds it
+func ResolveGeminiModel(model string) string {
+	model = strings.TrimPrefix(strings.TrimSpace(model), "models/")
+	if full, ok := geminiModelAliases[strings.ToLower(model)]; ok {
+		return full
+	}
+	return model
+}
+
+// DeprecatedGeminiModel returns the model to use instead of model, if model is a
+// known deprecated one
+func DeprecatedGeminiModel(model string) (string, bool) {
+	replacement := geminiModels[model]
+	return replacement, replacement != ""
+}
+
+// checkGeminiModel rejects a model name that is a near miss of a known model or
+// alias, such as gemini-1.5-flsh. Other unknown names, like versioned, preview or
+// newer models, are allowed through for the API to judge.
+func checkGeminiModel(model string) error {
+	if model == "" {
+		return fmt.Errorf("GEMINI_MODEL can't be empty")
+	}
+	if _, ok := geminiModels[model]; ok {
+		return nil
+	}
+
+	names := make([]string, 0, len(geminiModels)+len(geminiModelAliases))
+	for name := range geminiModels {
+		names = append(names, name)
+	}
+	for alias := range geminiModelAliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	// A typo keeps the version numbers but gets a letter or two wrong
+	for _, name := range names {
+		if versionDigits(name) == versionDigits(model) && editDistance(strings.ToLower(model), name) <= 2 {
+			return fmt.Errorf("unknown GEMINI_MODEL %q, did you mean %q? (aliases: flash, flash-lite, pro)", model, name)
+		}
+	}
+	return nil
+}
+
+// versionDigits returns the digits of a model name, such as "15" for gemini-1.5-flash
+func versionDigits(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// safetyCategories maps the short names GEMINI_SAFETY accepts to Gemini harm categories
+var safetyCategories = map[string]string{
+	"harassment":        "HARM_CATEGORY_HARASSMENT",
+	"hate":              "HARM_CATEGORY_HATE_SPEECH",
+	"hate_speech":       "HARM_CATEGORY_HATE_SPEECH",
+	"sexual":            "HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"sexually_explicit": "HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"dangerous":         "HARM_CATEGORY_DANGEROUS_CONTENT",
+	"dangerous_content": "HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+// defaultSafetyCategories are the categories a bare threshold applies to
+var defaultSafetyCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+// safetyThresholds are the block thresholds Gemini accepts
+var safetyThresholds = map[string]bool{
+	"BLOCK_NONE":             true,
+	"BLOCK_ONLY_HIGH":        true,
+	"BLOCK_MEDIUM_AND_ABOVE": true,
+	"BLOCK_LOW_AND_ABOVE":    true,
+	"OFF":                    true,
+}
+
+// ParseSafety parses Gemini safety thresholds given either as one threshold for
+// every category, such as block_none, or per category, such as
+// "harassment=block_none,hate=block_only_high". It returns the threshold of each
+// harm category.
+func ParseSafety(value string) (map[string]string, error) {
+	settings := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, threshold, perCategory := strings.Cut(item, "=")
+		if !perCategory {
+			name, threshold = "", name
+		}
+		threshold = strings.ToUpper(strings.TrimSpace(threshold))
+		if !safetyThresholds[threshold] {
+			return nil, fmt.Errorf("invalid GEMINI_SAFETY threshold %q: must be block_none, block_only_high, block_medium_and_above, block_low_and_above or off", threshold)
+		}
+
+		if !perCategory {
+			for _, category := range defaultSafetyCategories {
+				settings[category] = threshold
+			}
+			continue
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		category, ok := safetyCategories[name]
+		if !ok && strings.HasPrefix(strings.ToUpper(name), "HARM_CATEGORY_") {
+			category, ok = strings.ToUpper(name), true
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid GEMINI_SAFETY category %q: must be harassment, hate, sexual, dangerous or a HARM_CATEGORY_ name", name)
+		}
+		settings[category] = threshold
+	}
+	return settings, nil
+}
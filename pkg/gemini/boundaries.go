@@ -0,0 +1,34 @@
+package gemini
+
+import (
+	"sort"
+
+	"yt_enhancer/pkg/models"
+)
+
+// boundaryIndices returns, in order, the index of the first word starting at or
+// after each of the times in boundariesMs. Boundaries before the second word or
+// after the last word are dropped.
+func boundaryIndices(wordTimings []models.WordTiming, boundariesMs []int) []int {
+	seen := make(map[int]bool)
+	var indices []int
+	for _, ms := range boundariesMs {
+		i := sort.Search(len(wordTimings), func(i int) bool { return wordTimings[i].StartTime >= ms })
+		if i == 0 || i == len(wordTimings) || seen[i] {
+			continue
+		}
+		seen[i] = true
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// nextBoundary returns the first boundary index after start, if there is one
+func nextBoundary(boundaries []int, start int) (int, bool) {
+	i := sort.SearchInts(boundaries, start+1)
+	if i == len(boundaries) {
+		return 0, false
+	}
+	return boundaries[i], true
+}
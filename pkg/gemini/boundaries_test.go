@@ -0,0 +1,75 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"yt_enhancer/pkg/models"
+)
+
+func TestBoundaryIndices(t *testing.T) {
+	words := make([]models.WordTiming, 6)
+	for i := range words {
+		words[i] = models.WordTiming{ID: i, StartTime: i * 1000}
+	}
+
+	tests := []struct {
+		name         string
+		boundariesMs []int
+		want         []int
+	}{
+		{name: "none", boundariesMs: nil, want: nil},
+		{name: "at word starts", boundariesMs: []int{2000, 4000}, want: []int{2, 4}},
+		{name: "between words", boundariesMs: []int{500, 1500}, want: []int{1, 2}},
+		{name: "out of order and repeated", boundariesMs: []int{4000, 1500, 2000}, want: []int{2, 4}},
+		{name: "at the first word or after the last", boundariesMs: []int{0, 9000}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := boundaryIndices(words, tt.boundariesMs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("boundaryIndices = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSubtitlesWithBoundaries(t *testing.T) {
+	words := make([]models.WordTiming, 10)
+	for i := range words {
+		words[i] = models.WordTiming{ID: i, Word: fmt.Sprintf("w%d.", i), StartTime: i * 500}
+	}
+
+	// Answer each batch with one block holding its words, noting where it starts
+	var mu sync.Mutex
+	var starts []int
+	srv := newTestServer(t, func(prompt string) string {
+		data := prompt[strings.Index(prompt, "TRANSCRIPT DATA:"):]
+		var batch []models.WordTiming
+		json.Unmarshal([]byte(data[strings.Index(data, "["):]), &batch)
+		mu.Lock()
+		starts = append(starts, batch[0].ID)
+		mu.Unlock()
+		first, last := batch[0], batch[len(batch)-1]
+		return cannedReply([]models.SubtitleInput{
+			{StartWordIndex: first.ID, StartMs: first.StartTime, LastWordStartMs: last.StartTime, Text: first.Word},
+		})(prompt)
+	})
+	client := newTestClient(newTestConfig(t), srv)
+
+	// Runs sharing the client keep their own boundaries
+	if _, err := client.CreateSubtitlesWithOptions(context.Background(), words, RunOptions{Boundaries: []int{2000}}); err != nil {
+		t.Fatalf("CreateSubtitlesWithOptions: %v", err)
+	}
+	if _, err := client.CreateSubtitles(context.Background(), words); err != nil {
+		t.Fatalf("CreateSubtitles: %v", err)
+	}
+	if want := []int{0, 4, 0}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("batches started at words %v, want %v", starts, want)
+	}
+}
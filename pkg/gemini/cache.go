@@ -0,0 +1,74 @@
+package gemini
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// cacheKey identifies a reply by the backend, model, sampling settings and prompt
+// that produced it
+func (c *Client) cacheKey(prompt string) string {
+	model := c.config.GeminiModel
+	switch c.config.LLMProvider {
+	case "openai":
+		model = c.config.OpenAIModel
+	case "ollama":
+		model = c.config.OllamaModel
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%g\x00%t\x00", c.config.LLMProvider, model, c.config.Temperature(), c.config.Deterministic)
+	h.Write([]byte(prompt))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedResponse returns the cached reply to prompt, if the response cache is
+// enabled and has one
+func (c *Client) cachedResponse(prompt string) (string, bool) {
+	if c.config.GeminiCacheDir == "" {
+		return "", false
+	}
+
+	path := filepath.Join(c.config.GeminiCacheDir, c.cacheKey(prompt)+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	slog.Debug("using cached response", "path", path)
+	return string(data), true
+}
+
+// storeResponse caches the reply to prompt. Only replies that parsed cleanly are
+// stored, so a bad reply is requested again on the next run.
+func (c *Client) storeResponse(prompt, content string) {
+	if c.config.GeminiCacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.config.GeminiCacheDir, 0755); err != nil {
+		slog.Warn("failed to create response cache directory", "path", c.config.GeminiCacheDir, "error", err)
+		return
+	}
+
+	// Write to a temporary file first so concurrent runs never read a partial reply
+	path := filepath.Join(c.config.GeminiCacheDir, c.cacheKey(prompt)+".json")
+	tmp, err := os.CreateTemp(c.config.GeminiCacheDir, "response-*.tmp")
+	if err != nil {
+		slog.Warn("failed to cache response", "path", path, "error", err)
+		return
+	}
+	_, err = tmp.WriteString(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		slog.Warn("failed to cache response", "path", path, "error", err)
+	}
+}
@@ -0,0 +1,49 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"yt_enhancer/pkg/llm"
+)
+
+// checkTimeout bounds the request CheckAccess makes
+const checkTimeout = 30 * time.Second
+
+// CheckAccess verifies that the configured backend is reachable and accepts the
+// API key, for setup checks. Gemini is asked for the configured model's details,
+// which costs no tokens; other providers are checked with their health check or a
+// one-word prompt.
+func (c *Client) CheckAccess(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	if checker, ok := c.provider.(llm.HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+	if c.provider != c {
+		_, err := c.provider.GenerateSubtitles(ctx, "Reply with the single word OK.")
+		return err
+	}
+
+	// The key goes in a header so that it can't show up in a connection error
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/models/"+c.config.GeminiModel, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("x-goog-api-key", c.config.GeminiAPIKey)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making API request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &llm.StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package gemini
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"yt_enhancer/pkg/models"
+)
+
+// checkpointData is the saved progress of a run, one entry per word range
+type checkpointData struct {
+	Transcript string            `json:"transcript"` // Hash of the (redacted) word timings
+	Ranges     []rangeCheckpoint `json:"ranges"`
+}
+
+// rangeCheckpoint is the progress of one word range: the blocks produced so far
+// and the index of the next word to process
+type rangeCheckpoint struct {
+	Start     int               `json:"start"`
+	End       int               `json:"end"`
+	Next      int               `json:"next"`
+	Subtitles []models.Subtitle `json:"subtitles"`
+}
+
+// checkpoint saves the progress of a run to a file after each batch. It is safe
+// for concurrent use by the workers of a run.
+type checkpoint struct {
+	path string
+	mu   sync.Mutex
+	data checkpointData
+}
+
+// CheckpointPath returns the checkpoint file kept next to outputPath while it is
+// being generated, e.g. video.partial.json for video.srt
+func CheckpointPath(outputPath string) string {
+	return outputPath[:len(outputPath)-len(filepath.Ext(outputPath))] + ".partial.json"
+}
+
+// CreateSubtitlesWithCheckpoint is CreateSubtitlesForLanguage, saving its progress
+// to checkpointPath after each batch. With resume set, a checkpoint left there by
+// an earlier run over the same words is loaded and only the remaining words are
+// sent. The checkpoint stays in place when the run succeeds; remove it with
+// RemoveCheckpoint once the output is written.
+func (c *Client) CreateSubtitlesWithCheckpoint(ctx context.Context, wordTimings []models.WordTiming,
+	language, checkpointPath string, resume bool) ([]models.Subtitle, error) {
+	return c.createSubtitles(ctx, wordTimings, RunOptions{Language: language, CheckpointPath: checkpointPath, Resume: resume})
+}
+
+// RemoveCheckpoint deletes the checkpoint file at path, if there is one
+func RemoveCheckpoint(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// openCheckpoint prepares the checkpoint at path for a run over wordTimings split
+// into ranges. With resume set, the progress saved there is loaded; it must have
+// been made for the same words and ranges.
+func openCheckpoint(path string, resume bool, wordTimings []models.WordTiming, ranges [][2]int) (*checkpoint, error) {
+	cp := &checkpoint{path: path, data: checkpointData{Transcript: transcriptHash(wordTimings)}}
+	for _, r := range ranges {
+		cp.data.Ranges = append(cp.data.Ranges, rangeCheckpoint{Start: r[0], End: r[1], Next: r[0]})
+	}
+	if !resume {
+		return cp, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("no checkpoint to resume from, starting from the beginning", "path", path)
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint: %w", err)
+	}
+
+	var saved checkpointData
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return nil, fmt.Errorf("error parsing checkpoint %s: %w", path, err)
+	}
+	if saved.Transcript != cp.data.Transcript || !sameRanges(saved.Ranges, cp.data.Ranges) {
+		return nil, fmt.Errorf("checkpoint %s was made for different captions or batch settings; delete it to start over", path)
+	}
+
+	cp.data = saved
+	return cp, nil
+}
+
+// sameRanges reports whether two checkpoints split the words the same way
+func sameRanges(a, b []rangeCheckpoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Start != b[i].Start || a[i].End != b[i].End || a[i].Next < a[i].Start {
+			return false
+		}
+	}
+	return true
+}
+
+// transcriptHash identifies the words a checkpoint was made for
+func transcriptHash(wordTimings []models.WordTiming) string {
+	data, _ := json.Marshal(wordTimings)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// resumed returns the saved progress of range i: the blocks produced so far and
+// the index of the next word to process
+func (cp *checkpoint) resumed(i int) ([]models.Subtitle, int) {
+	if cp == nil {
+		return nil, -1
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	r := cp.data.Ranges[i]
+	return append([]models.Subtitle(nil), r.Subtitles...), r.Next
+}
+
+// wordsDone returns the number of words processed in the saved progress
+func (cp *checkpoint) wordsDone() int {
+	if cp == nil {
+		return 0
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	done := 0
+	for _, r := range cp.data.Ranges {
+		done += min(r.Next, r.End) - r.Start
+	}
+	return done
+}
+
+// save records that range i has produced subtitles and continues at next, and
+// writes the checkpoint file. A failed write is logged rather than failing the run.
+func (cp *checkpoint) save(i int, subtitles []models.Subtitle, next int) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.data.Ranges[i].Subtitles = subtitles
+	cp.data.Ranges[i].Next = next
+
+	data, err := json.Marshal(cp.data)
+	if err == nil {
+		// The output directory may not exist yet
+		err = os.MkdirAll(filepath.Dir(cp.path), 0755)
+	}
+	if err == nil {
+		// Replace the file in one step so a crash never leaves it half written
+		tmp := cp.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, cp.path)
+		}
+	}
+	if err != nil {
+		slog.Warn("failed to save checkpoint", "path", cp.path, "error", err)
+	}
+}
@@ -2,142 +2,742 @@ package gemini
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"yt_enhancer/pkg/config"
+	"yt_enhancer/pkg/llm"
 	"yt_enhancer/pkg/models"
+	"yt_enhancer/pkg/ollama"
+	"yt_enhancer/pkg/openai"
+	"yt_enhancer/pkg/redact"
+	"yt_enhancer/pkg/subtitle"
 )
 
-// Client is a client for the Gemini API
+// Client is a client for the Gemini API. It is safe for concurrent use, so one
+// client can be shared by several conversions to respect a single rate limit.
 type Client struct {
 	config     *config.Config
 	httpClient *http.Client
 	debugMode  bool
 	debugDir   string
+	limiter    *rateLimiter
+	usageMu    sync.Mutex
+	usage      Usage
+	redactor   *redact.Redactor
+	provider   llm.Provider
+	batchSize  int
+	baseURL    string
+	promptOnce sync.Once
+	prompt     *template.Template
+	promptErr  error
+
+	debugDirOnce sync.Once
+	debugDirErr  error
+	debugRuns    atomic.Int64
+
+	// OnProgress, if set, is called at the start and end of each batch of
+	// CreateSubtitles. Calls never overlap, even with concurrent batches.
+	OnProgress ProgressFunc
+
+	// Metrics, if set, receives the latency, outcome and token usage of each API
+	// request, and the batches that had to be requested again
+	Metrics Metrics
 }
 
 // Response structures for Gemini API
 type Response struct {
-	Candidates []Candidate `json:"candidates"`
+	Candidates     []Candidate    `json:"candidates"`
+	PromptFeedback PromptFeedback `json:"promptFeedback"`
+	UsageMetadata  UsageMetadata  `json:"usageMetadata"`
+}
+
+// PromptFeedback says why Gemini refused a prompt, such as SAFETY when a safety
+// filter blocked it
+type PromptFeedback struct {
+	BlockReason string `json:"blockReason"`
 }
 
 type Candidate struct {
 	Content struct {
 		Parts []Part `json:"parts"`
 	} `json:"content"`
+	FinishReason string `json:"finishReason"` // Why the model stopped, such as STOP or MAX_TOKENS
 }
 
 type Part struct {
 	Text string `json:"text,omitempty"`
 }
 
-// NewClient creates a new Gemini API client
+var (
+	// ErrLowCoverage is returned when a batch response covers too few of its words
+	ErrLowCoverage = errors.New("response covers too little of the batch")
+
+	// ErrInvalidIndices is returned when a batch response has subtitles whose
+	// st_id values are outside the batch or not strictly increasing
+	ErrInvalidIndices = errors.New("response has invalid word indices")
+
+	// ErrEmptyResponse is returned when the model replies to a batch with no content
+	ErrEmptyResponse = errors.New("response is empty")
+
+	// ErrMalformedResponse is returned when a batch response isn't a valid JSON
+	// array of subtitles, often because the model ran out of room mid-reply
+	ErrMalformedResponse = errors.New("response is not a valid subtitle array")
+
+	// ErrBlocked is returned when Gemini refuses a prompt or stops its reply,
+	// usually because a safety filter blocked it
+	ErrBlocked = errors.New("blocked")
+)
+
+// PartialError is returned when a run fails after some of its batches were done.
+// Subtitles holds their blocks in transcript order, so they can be salvaged.
+type PartialError struct {
+	Subtitles []models.Subtitle
+	Err       error
+}
+
+func (e *PartialError) Error() string { return e.Err.Error() }
+func (e *PartialError) Unwrap() error { return e.Err }
+
+const (
+	defaultBatchSize  = 300 // Maximum number of words sent in one request
+	localBatchSize    = 100 // Batch size for local models with small context windows
+	minRetryBatchSize = 20  // Smallest batch size used when retrying a batch
+	maxEmptyBatches   = 3   // Consecutive empty responses tolerated before giving up
+
+	requestTimeoutBase    = 60 * time.Second       // Time allowed for any Gemini request
+	requestTimeoutPerWord = 250 * time.Millisecond // Extra time allowed per word in the request
+	maxRequestTimeout     = 10 * time.Minute       // Upper bound on the time allowed for a request
+)
+
+// parseOptions controls how batch responses are validated and converted to subtitles
+type parseOptions struct {
+	lastWordPadMs  int     // Display time added after the last word's start
+	lastWordCharMs float64 // Extra display time per character of the last word
+	minDurationMs  int     // Minimum display time of a subtitle
+	minCoverage    float64 // Minimum fraction of the batch the response must cover
+	gapMs          int     // Gap kept before the next subtitle's start
+	modelTimings   bool    // Keep the model's st_ms and lw_ms instead of the source words' timings
+}
+
+// NewClient creates a new Gemini API client. Batches are sent to the provider
+// selected by cfg.LLMProvider, which defaults to Gemini itself.
 func NewClient(cfg *config.Config) *Client {
-	return &Client{
+	c := &Client{
 		config: cfg,
-		httpClient: &http.Client{
-			Timeout: 120 * time.Second, // Extended timeout for processing the entire transcript
-		},
-		debugMode: cfg.DebugMode,
-		debugDir:  cfg.DebugDir,
+		// Requests are bounded per batch by requestContext instead of a fixed timeout
+		httpClient: &http.Client{Transport: newTransport(cfg.GeminiProxy)},
+		debugMode:  cfg.DebugMode,
+		debugDir:   cfg.DebugDir,
+		limiter:    newRateLimiter(cfg.GeminiRequestsPerMinute),
+		batchSize:  defaultBatchSize,
+		baseURL:    strings.TrimSuffix(cfg.GeminiBaseURL, "/") + "/" + strings.Trim(cfg.GeminiAPIVersion, "/"),
+	}
+
+	// Select the backend batches are sent to
+	switch cfg.LLMProvider {
+	case "ollama":
+		provider := ollama.NewClient(cfg)
+		provider.OnUsage = func(promptTokens, outputTokens int) {
+			c.recordUsage(UsageMetadata{PromptTokenCount: promptTokens, CandidatesTokenCount: outputTokens})
+		}
+		c.provider = provider
+		c.batchSize = localBatchSize
+	case "openai":
+		provider := openai.NewClient(cfg)
+		provider.OnUsage = func(promptTokens, outputTokens int) {
+			c.recordUsage(UsageMetadata{PromptTokenCount: promptTokens, CandidatesTokenCount: outputTokens})
+		}
+		c.provider = provider
+	default:
+		c.provider = c
+		if replacement, ok := config.DeprecatedGeminiModel(cfg.GeminiModel); ok {
+			slog.Warn("GEMINI_MODEL is deprecated and may stop working", "model", cfg.GeminiModel, "use", replacement)
+		}
+	}
+
+	if cfg.GeminiBatchSize > 0 {
+		c.batchSize = cfg.GeminiBatchSize
 	}
+	return c
+}
+
+// newTransport returns the HTTP transport for Gemini requests. Without proxyURL it
+// is Go's default, which honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY; otherwise
+// every request goes through proxyURL, which may be an http, https or socks5 proxy.
+func newTransport(proxyURL string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL == "" {
+		return transport
+	}
+
+	proxy, err := url.Parse(proxyURL)
+	if err != nil {
+		slog.Warn("ignoring invalid GEMINI_PROXY", "error", err)
+		return transport
+	}
+	transport.Proxy = http.ProxyURL(proxy)
+	return transport
+}
+
+// SetProvider replaces the backend that batches are sent to, keeping the shared
+// prompt building, validation and response parsing
+func (c *Client) SetProvider(provider llm.Provider) {
+	c.provider = provider
 }
 
-// CreateSubtitles creates subtitle blocks from word timings using Gemini API
-func (c *Client) CreateSubtitles(wordTimings []models.WordTiming) ([]models.Subtitle, error) {
-	// Create debug directory if it doesn't exist
-	if c.debugMode && c.debugDir != "" {
-		if err := os.MkdirAll(c.debugDir, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create debug directory: %w", err)
+// SetBaseURL points Gemini requests at another server, such as a proxy or a
+// local stand-in for the API, overriding GeminiBaseURL and GeminiAPIVersion.
+// The URL includes the version path.
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// EnableRedaction makes the client replace text matching patterns with placeholders
+// before it is sent to the API, restoring the original text in the returned subtitles
+func (c *Client) EnableRedaction(patterns []string) error {
+	redactor, err := redact.New(patterns)
+	if err != nil {
+		return err
+	}
+	c.redactor = redactor
+	return nil
+}
+
+// CreateSubtitles creates subtitle blocks from word timings using Gemini API.
+// Cancelling ctx aborts the in-flight request. When the run fails or is cancelled
+// after some batches were done, the error is a *PartialError holding their blocks.
+func (c *Client) CreateSubtitles(ctx context.Context, wordTimings []models.WordTiming) ([]models.Subtitle, error) {
+	return c.CreateSubtitlesForLanguage(ctx, wordTimings, "")
+}
+
+// CreateSubtitlesForLanguage is CreateSubtitles for a transcript in the given
+// language, such as "th" or "en", which sets the prompt's Language line. An empty
+// language uses the default Thai prompt.
+func (c *Client) CreateSubtitlesForLanguage(ctx context.Context, wordTimings []models.WordTiming, language string) ([]models.Subtitle, error) {
+	return c.CreateSubtitlesWithOptions(ctx, wordTimings, RunOptions{Language: language})
+}
+
+// RunOptions are the optional behaviors of one run of the batch pipeline. They
+// apply to that run only, so runs sharing a client can each set their own.
+type RunOptions struct {
+	Language       string                // Language line of the prompt, such as "th"; empty uses the default Thai prompt
+	OnSubtitle     func(models.Subtitle) // Called with each block as soon as it is known (see CreateSubtitlesStream)
+	CheckpointPath string                // File the progress is saved to after each batch (see CreateSubtitlesWithCheckpoint)
+	Resume         bool                  // Continue from the progress saved in CheckpointPath
+
+	// Boundaries are times in ms, such as the starts of video chapters, that end a
+	// batch, so that no batch holds words from both sides of one and sentences
+	// aren't merged across a change of topic. The first batch after a boundary
+	// starts at it.
+	Boundaries []int
+
+	// OnProgress, if set, is called like the client's OnProgress, but only for
+	// this run's batches
+	OnProgress ProgressFunc
+}
+
+// CreateSubtitlesWithOptions is CreateSubtitles with the given run options
+func (c *Client) CreateSubtitlesWithOptions(ctx context.Context, wordTimings []models.WordTiming, opts RunOptions) ([]models.Subtitle, error) {
+	return c.createSubtitles(ctx, wordTimings, opts)
+}
+
+// createSubtitles runs the batch pipeline with the given options
+func (c *Client) createSubtitles(ctx context.Context, wordTimings []models.WordTiming, opts RunOptions) ([]models.Subtitle, error) {
+	language := opts.Language
+
+	// Name this run's debug files so they don't collide with other runs'
+	ctx, err := c.startDebugRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redact sensitive text before it leaves the machine
+	var mapping redact.Mapping
+	if c.redactor != nil {
+		wordTimings, mapping = c.redactor.Redact(wordTimings)
+		slog.Debug("redacted sensitive values", "count", len(mapping))
+	}
+
+	// Load a custom prompt template before any batch is sent
+	if _, err := c.promptTemplate(); err != nil {
+		return nil, err
+	}
+
+	// Make sure the backend is up before doing any work
+	if checker, ok := c.provider.(llm.HealthChecker); ok {
+		if err := checker.HealthCheck(ctx); err != nil {
+			return nil, err
 		}
 	}
 
-	// Process in batches of maximum 300 words
+	// Split the transcript into ranges processed by a bounded pool of workers
+	ranges := batchRanges(len(wordTimings), c.batchSize, c.config.GeminiConcurrency)
+	boundaries := boundaryIndices(wordTimings, opts.Boundaries)
+	results := make([][]models.Subtitle, len(ranges))
+	errs := make([]error, len(ranges))
+
+	// Save progress after each batch, picking up where an earlier run stopped
+	var cp *checkpoint
+	if opts.CheckpointPath != "" {
+		var err error
+		if cp, err = openCheckpoint(opts.CheckpointPath, opts.Resume, wordTimings, ranges); err != nil {
+			return nil, err
+		}
+		if done := cp.wordsDone(); done > 0 {
+			slog.Info("resuming from checkpoint", "path", opts.CheckpointPath, "words_done", done, "words", len(wordTimings))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := c.config.GeminiConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	progress := newRunProgress(c.OnProgress, ranges, c.batchSize)
+	progress.wordsDone = cp.wordsDone()
+	if opts.OnProgress != nil {
+		report := progress.report
+		progress.report = func(batchNum, totalBatches, wordsDone, wordsTotal int) {
+			if report != nil {
+				report(batchNum, totalBatches, wordsDone, wordsTotal)
+			}
+			opts.OnProgress(batchNum, totalBatches, wordsDone, wordsTotal)
+		}
+	}
+	if opts.OnSubtitle != nil {
+		progress.onSubtitle = func(sub models.Subtitle) {
+			sub.Text = mapping.Restore(sub.Text)
+			opts.OnSubtitle(sub)
+		}
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = c.processRange(ctx, wordTimings, i, ranges[i][0], ranges[i][1], language,
+					boundaries, progress, cp)
+				if errs[i] != nil {
+					// Stop the other workers; their work would be discarded anyway
+					cancel()
+				}
+			}
+		}()
+	}
+	for i := range ranges {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Collect results in transcript order, reporting the first real failure
+	// rather than the cancellations it caused
 	var allSubtitles []models.Subtitle
-	var startIndex int = 0
-	var batchNum int = 1
-	var batchSize int = 300
+	var firstErr error
+	for i := range ranges {
+		if errs[i] != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+			firstErr = errs[i]
+		}
+		if len(allSubtitles) > 0 {
+			results[i] = dedupeSeam(allSubtitles[len(allSubtitles)-1], results[i])
+		}
+		allSubtitles = append(allSubtitles, results[i]...)
+	}
+
+	// Restore redacted text in the output
+	for i := range allSubtitles {
+		allSubtitles[i].Text = mapping.Restore(allSubtitles[i].Text)
+	}
+
+	// Post-process to ensure consistent transitions between subtitle blocks
+	allSubtitles = subtitle.NormalizeTimeline(allSubtitles, c.config.SubtitleGapMs)
+	if firstErr != nil {
+		if len(allSubtitles) > 0 {
+			return nil, &PartialError{Subtitles: allSubtitles, Err: firstErr}
+		}
+		return nil, firstErr
+	}
+	return allSubtitles, nil
+}
+
+// batchRanges splits a transcript of n words into [start, end) ranges that can be
+// processed independently. With a concurrency of one the whole transcript is a
+// single range so that each batch continues exactly where the previous one stopped.
+func batchRanges(n, batchSize, concurrency int) [][2]int {
+	if concurrency <= 1 {
+		return [][2]int{{0, n}}
+	}
+
+	var ranges [][2]int
+	for start := 0; start < n; start += batchSize {
+		end := start + batchSize
+		if end > n {
+			end = n
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges
+}
+
+// processRange processes the words in [rangeStart, rangeEnd) in consecutive batches,
+// each continuing from the last subtitle of the previous one. Each batch is preceded
+// by up to GeminiBatchOverlap earlier words as context, and blocks starting in that
+// context are dropped from the output. A batch never runs past the next of the
+// word indices in boundaries. progress numbers the batches across all ranges and
+// reports the words done. The range's progress is saved to cp, if set, as range
+// rangeIndex after each batch, and a range it holds progress for resumes from there.
+// On failure it returns the subtitles of the batches done so far along with the error.
+func (c *Client) processRange(ctx context.Context, wordTimings []models.WordTiming, rangeIndex,
+	rangeStart, rangeEnd int, language string, boundaries []int, progress *runProgress, cp *checkpoint) ([]models.Subtitle, error) {
+
+	subtitles, startIndex := cp.resumed(rangeIndex)
+	if startIndex < rangeStart {
+		startIndex = rangeStart
+	}
+	if startIndex >= rangeEnd {
+		return subtitles, nil
+	}
+
+	var batchSize int = c.batchSize
+	var currentSize = batchSize
+	var batchNum = progress.nextBatch()
+	c.recordBatch()
+	var reRequested bool
+	var emptyBatches int
+	var splitEnd int // End of the last batch split in half; words before it are sent at the smaller size
+
+	for startIndex < rangeEnd {
+		// Stop between batches if the caller gave up
+		if err := ctx.Err(); err != nil {
+			return subtitles, err
+		}
+
+		// Calculate batch size (less than the maximum when retrying)
+		endIndex := startIndex + currentSize
+		if endIndex > rangeEnd {
+			endIndex = rangeEnd
+		}
 
-	for startIndex < len(wordTimings) {
-		// Calculate batch size (maximum 300 words)
-		endIndex := startIndex + batchSize
-		if endIndex > len(wordTimings) {
-			endIndex = len(wordTimings)
+		// End the batch at a boundary such as a chapter start, where its last
+		// sentence ends too
+		atBoundary := false
+		if boundary, ok := nextBoundary(boundaries, startIndex); ok && boundary < endIndex {
+			endIndex, atBoundary = boundary, true
 		}
 
-		// Get the current batch
-		currentBatch := wordTimings[startIndex:endIndex]
+		// Get the current batch, with the preceding overlap words as context
+		batchStart := startIndex - c.batchOverlap()
+		if batchStart < 0 {
+			batchStart = 0
+		}
+		currentBatch := wordTimings[batchStart:endIndex]
 
-		fmt.Printf("Processing batch %d: words %d to %d (total: %d)\n",
-			batchNum, startIndex, endIndex-1, len(currentBatch))
+		slog.Info("processing batch", "batch", batchNum,
+			"first_word", startIndex, "last_word", endIndex-1, "words", endIndex-startIndex,
+			"context_words", startIndex-batchStart)
+		progress.startBatch(batchNum)
 
 		// Process the current batch
-		subtitles, lastWordIndex, err := c.processBatch(
+		batchSubtitles, nextIndex, err := c.processBatch(
+			ctx,
 			currentBatch,
-			wordTimings,
+			batchStart,
 			startIndex,
+			endIndex >= rangeEnd || atBoundary,
+			language,
 			batchNum,
+			progress,
 		)
-		if err != nil {
-			return nil, err
+		if errors.Is(err, ErrLowCoverage) && currentSize/2 >= minRetryBatchSize {
+			// Retry the same words as a smaller batch
+			currentSize /= 2
+			c.recordRetry("low_coverage")
+			slog.Warn("retrying batch with fewer words", "batch", batchNum, "error", err, "words", currentSize)
+			continue
+		}
+		if (errors.Is(err, llm.ErrTruncated) || errors.Is(err, ErrMalformedResponse)) && currentSize/2 >= minRetryBatchSize {
+			// The reply didn't fit the output token limit, or broke off mid-JSON, so
+			// split the batch in half. Both halves, and any halves they split into,
+			// are sent at the smaller size before going back to the full batch size.
+			currentSize /= 2
+			splitEnd = max(splitEnd, endIndex)
+			reason := "truncated"
+			if !errors.Is(err, llm.ErrTruncated) {
+				reason = "malformed"
+			}
+			c.recordRetry(reason)
+			slog.Warn("splitting batch", "batch", batchNum, "reason", reason, "words", currentSize)
+			continue
+		}
+		if errors.Is(err, ErrInvalidIndices) && c.config.RetryInvalidBatches && !reRequested {
+			// Dropped or reordered words are often a one-off, so ask once more
+			reRequested = true
+			c.recordRetry("invalid_indices")
+			slog.Warn("requesting batch again", "batch", batchNum, "error", err)
+			continue
+		}
+		if errors.Is(err, ErrEmptyResponse) {
+			// Skip the batch rather than losing the whole run, unless the model
+			// keeps returning nothing
+			emptyBatches++
+			if emptyBatches >= maxEmptyBatches {
+				return subtitles, fmt.Errorf("%d consecutive batches came back empty, try a smaller GEMINI_BATCH_SIZE: %w",
+					emptyBatches, err)
+			}
+			slog.Warn("skipping batch with empty response", "batch", batchNum,
+				"first_word", startIndex, "last_word", endIndex-1)
+			batchSubtitles, nextIndex, err = nil, endIndex, nil
+		} else if err != nil {
+			return subtitles, err
+		} else {
+			emptyBatches = 0
 		}
 
-		// Add the processed subtitles to our result
-		allSubtitles = append(allSubtitles, subtitles...)
-
-		// Update the start index for the next batch
-		startIndex = lastWordIndex
-		batchNum++
+		// Add the processed subtitles to our result, without any repeat of the
+		// previous batch's last block
+		if len(subtitles) > 0 {
+			batchSubtitles = dedupeSeam(subtitles[len(subtitles)-1], batchSubtitles)
+		}
+		subtitles = append(subtitles, batchSubtitles...)
+		reRequested = false
 
-		if len(currentBatch) < batchSize {
+		if endIndex >= rangeEnd {
+			cp.save(rangeIndex, subtitles, rangeEnd)
+			progress.finishBatch(batchNum, rangeEnd-startIndex)
 			break
 		}
-	}
 
-	// Post-process to ensure consistent transitions between subtitle blocks
-	if len(allSubtitles) > 1 {
-		for i := 1; i < len(allSubtitles); i++ {
-			// Ensure no subtitle end time is after the next subtitle's start time
-			if allSubtitles[i-1].EndMs > allSubtitles[i].StartMs {
-				allSubtitles[i-1].EndMs = allSubtitles[i].StartMs - 100 // 100ms gap
-			}
+		// Update the start index for the next batch, making sure we always advance
+		if nextIndex <= startIndex {
+			nextIndex = endIndex
+		}
+		cp.save(rangeIndex, subtitles, nextIndex)
+		progress.finishBatch(batchNum, nextIndex-startIndex)
+		startIndex = nextIndex
+		batchNum = progress.nextBatch()
+		c.recordBatch()
+		if startIndex >= splitEnd {
+			currentSize = batchSize
 		}
 	}
 
-	return allSubtitles, nil
+	return subtitles, nil
 }
 
-// processBatch processes a batch of word timings and returns the created subtitles,
-// along with the index of the last processed word
-func (c *Client) processBatch(batch []models.WordTiming, allWords []models.WordTiming,
-	startIndex int, batchNum int) ([]models.Subtitle, int, error) {
+// processBatch processes a batch of word timings starting at global index startIndex
+// and returns the created subtitles, along with the index of the word the next batch
+// starts at. Subtitles starting before newFrom cover context words already processed
+// by the previous batch and are dropped. final marks the last batch of a range,
+// which has nothing to carry an unfinished sentence forward to.
+func (c *Client) processBatch(ctx context.Context, batch []models.WordTiming,
+	startIndex, newFrom int, final bool, language string, batchNum int, progress *runProgress) ([]models.Subtitle, int, error) {
 
 	// Include the global start index information in the request to maintain proper indexing
-	prompt := buildBatchPrompt(batch, startIndex > 0)
-
-	// Add the global start index to help the model understand word positions
-	if startIndex > 0 {
-		indexInfo := fmt.Sprintf("\nIMPORTANT: These words start at global index %d in the full transcript.\n", startIndex)
-		prompt = strings.Replace(prompt, "TRANSCRIPT DATA:", "TRANSCRIPT DATA:"+indexInfo, 1)
+	tmpl, err := c.promptTemplate()
+	if err != nil {
+		return nil, 0, err
+	}
+	prompt, err := buildBatchPrompt(tmpl, batch, startIndex, c.languageLine(language))
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// Debug: Save prompt to file
-	if c.debugMode && c.debugDir != "" {
-		promptFile := filepath.Join(c.debugDir, fmt.Sprintf("batch_%d_prompt.txt", batchNum))
-		if err := os.WriteFile(promptFile, []byte(prompt), 0644); err != nil {
-			fmt.Printf("Warning: Failed to save debug prompt: %v\n", err)
-		} else if c.debugMode {
-			fmt.Printf("Saved prompt to %s\n", promptFile)
+	c.saveDebugFile(ctx, fmt.Sprintf("batch_%d_prompt.txt", batchNum), "prompt", batchNum, []byte(prompt))
+
+	// Reuse the reply to an identical earlier request, if cached
+	content, cached := c.cachedResponse(prompt)
+	streamed := false
+	if !cached {
+		// Respect the shared request rate limit
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, 0, err
+		}
+
+		// Ask the configured provider for the subtitle blocks, streaming them when
+		// the caller wants each block as soon as it is known
+		reqCtx, cancel := c.requestContext(ctx, len(batch))
+		started := time.Now()
+		var streamer llm.StreamProvider
+		streamer, streamed = c.provider.(llm.StreamProvider)
+		streamed = streamed && progress.streaming()
+		if streamed {
+			content, err = c.streamBatch(reqCtx, streamer, prompt, batch, newFrom, progress)
+		} else {
+			content, err = c.provider.GenerateSubtitles(reqCtx, prompt)
+		}
+		cancel()
+		c.observeRequest(ctx, started, err)
+		if err != nil {
+			return nil, 0, c.requestError(ctx, err)
 		}
 	}
 
+	// Debug: Save the model's reply to file
+	c.saveDebugFile(ctx, fmt.Sprintf("batch_%d_response.json", batchNum), "response", batchNum, []byte(content))
+
+	// Process the response
+	subtitles, nextIndex, err := parseBatchResponse(content, batch, startIndex, newFrom, final, c.parseOptions())
+	if err != nil {
+		return nil, 0, err
+	}
+	if !cached {
+		c.storeResponse(prompt, content)
+	}
+	if !streamed {
+		for _, sub := range subtitles {
+			progress.emit(sub)
+		}
+	}
+
+	// Debug: Log processed subtitles info
+	if c.debugMode {
+		slog.Debug("processed batch", "batch", batchNum, "words", len(batch),
+			"subtitles", len(subtitles), "next_word", nextIndex)
+
+		// Save processed subtitles to file
+		subtitlesJSON, _ := json.MarshalIndent(subtitles, "", "  ")
+		c.saveDebugFile(ctx, fmt.Sprintf("batch_%d_subtitles.json", batchNum), "subtitles", batchNum, subtitlesJSON)
+	}
+
+	return subtitles, nextIndex, nil
+}
+
+// requestContext bounds a request for words words. With Gemini as the provider, it
+// gets GeminiRequestTimeout seconds, or a deadline that grows with the number of
+// words, capped at maxRequestTimeout. Other providers use their own HTTP timeouts.
+func (c *Client) requestContext(ctx context.Context, words int) (context.Context, context.CancelFunc) {
+	if _, ok := c.provider.(*Client); !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.requestTimeout(words))
+}
+
+// requestTimeout returns the time allowed for a Gemini request for words words
+func (c *Client) requestTimeout(words int) time.Duration {
+	timeout := requestTimeoutBase + time.Duration(words)*requestTimeoutPerWord
+	if c.config.GeminiRequestTimeout > 0 {
+		timeout = time.Duration(c.config.GeminiRequestTimeout) * time.Second
+	}
+	return min(timeout, maxRequestTimeout)
+}
+
+// requestError explains a request that ran out of time while the run itself was
+// still going
+func (c *Client) requestError(ctx context.Context, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("request timed out (set GEMINI_REQUEST_TIMEOUT to allow more time): %w", err)
+	}
+	return err
+}
+
+// GenerateSubtitles sends a prompt to the Gemini API and returns the text of the
+// first candidate. It implements llm.Provider.
+func (c *Client) GenerateSubtitles(ctx context.Context, prompt string) (string, error) {
+	resp, err := c.sendRequest(ctx, "generateContent", prompt)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Read the response
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	var geminiResp Response
+	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
+		return "", fmt.Errorf("error parsing API response: %w", err)
+	}
+
+	// Track token usage reported by the API
+	c.recordUsage(geminiResp.UsageMetadata)
+
+	// A blocked prompt comes back without candidates
+	if err := blockedError(geminiResp.PromptFeedback); err != nil {
+		return "", err
+	}
+
+	// Validate response structure
+	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no content in the API response: %w", ErrEmptyResponse)
+	}
+
+	if err := c.finishError(geminiResp.Candidates[0].FinishReason); err != nil {
+		return "", err
+	}
+
+	return geminiResp.Candidates[0].Content.Parts[0].Text, nil
+}
+
+// finishError returns an error if the model stopped its reply for a reason that
+// leaves it unusable: the output token limit, or a safety or recitation filter
+func (c *Client) finishError(reason string) error {
+	switch reason {
+	case "MAX_TOKENS":
+		return fmt.Errorf("%w (GEMINI_MAX_TOKENS is %d); raise it or lower GEMINI_BATCH_SIZE",
+			llm.ErrTruncated, c.config.GeminiMaxTokens)
+	case "SAFETY":
+		return fmt.Errorf("response %w by the Gemini safety filters (finish reason %s); set GEMINI_SAFETY=block_none to relax them",
+			ErrBlocked, reason)
+	case "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return fmt.Errorf("response %w by Gemini (finish reason %s)", ErrBlocked, reason)
+	}
+	return nil
+}
+
+// blockedError returns an error naming the reason Gemini blocked the prompt, if it did
+func blockedError(feedback PromptFeedback) error {
+	if feedback.BlockReason == "" {
+		return nil
+	}
+	if feedback.BlockReason == "SAFETY" {
+		return fmt.Errorf("prompt %w by the Gemini safety filters (reason %s); set GEMINI_SAFETY=block_none to relax them",
+			ErrBlocked, feedback.BlockReason)
+	}
+	return fmt.Errorf("prompt %w by Gemini (reason %s)", ErrBlocked, feedback.BlockReason)
+}
+
+// safetySettings returns the safetySettings request field for thresholds keyed by
+// harm category, sorted by category so identical settings give identical requests
+func safetySettings(thresholds map[string]string) []map[string]string {
+	categories := make([]string, 0, len(thresholds))
+	for category := range thresholds {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	settings := make([]map[string]string, len(categories))
+	for i, category := range categories {
+		settings[i] = map[string]string{"category": category, "threshold": thresholds[category]}
+	}
+	return settings
+}
+
+// sendRequest sends prompt to the Gemini API method, such as generateContent, and
+// returns the response once the API has accepted the request. The caller must close
+// the response body.
+func (c *Client) sendRequest(ctx context.Context, method, prompt string) (*http.Response, error) {
 	// Create the Gemini API request with temperature parameter
 	geminiReq := map[string]interface{}{
 		"contents": []map[string]interface{}{
@@ -150,172 +750,207 @@ func (c *Client) processBatch(batch []models.WordTiming, allWords []models.WordT
 			},
 		},
 		"generationConfig": map[string]interface{}{
-			"temperature":     c.config.GeminiTemperature,
+			"temperature":     c.config.Temperature(),
 			"maxOutputTokens": c.config.GeminiMaxTokens,
 		},
 	}
 
+	// Relax or tighten the safety filters if configured
+	if len(c.config.GeminiSafety) > 0 {
+		geminiReq["safetySettings"] = safetySettings(c.config.GeminiSafety)
+	}
+
+	// Pin sampling down as far as the API allows
+	if c.config.Deterministic {
+		generationConfig := geminiReq["generationConfig"].(map[string]interface{})
+		generationConfig["seed"] = config.DeterministicSeed
+		generationConfig["topK"] = 1
+	}
+
 	reqBody, err := json.Marshal(geminiReq)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error marshaling request: %w", err)
+		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	// Make the API request using the specified model
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s",
-		c.config.GeminiModel, c.config.GeminiAPIKey)
-
-	if c.debugMode {
-		fmt.Printf("Sending request to Gemini API (model: %s)\n", c.config.GeminiModel)
+	// Make the API request using the specified model; streamed replies are sent as
+	// server-sent events
+	url := fmt.Sprintf("%s/models/%s:%s?key=%s",
+		c.baseURL, c.config.GeminiModel, method, c.config.GeminiAPIKey)
+	if method == "streamGenerateContent" {
+		url += "&alt=sse"
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
+	slog.Debug("sending request to Gemini API", "model", c.config.GeminiModel, "method", method)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
 	if err != nil {
-		return nil, 0, fmt.Errorf("error creating request: %w", err)
+		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error making API request: %w", err)
+		return nil, fmt.Errorf("error making API request: %w", err)
 	}
-	defer resp.Body.Close()
 
-	// Read the response
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, 0, fmt.Errorf("error reading response: %w", err)
+	// Check if the request was successful
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, &llm.StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
+	return resp, nil
+}
 
-	// Debug: Save raw response to file
-	if c.debugMode && c.debugDir != "" {
-		respFile := filepath.Join(c.debugDir, fmt.Sprintf("batch_%d_response.json", batchNum))
-		if err := os.WriteFile(respFile, respBody, 0644); err != nil {
-			fmt.Printf("Warning: Failed to save debug response: %v\n", err)
-		} else if c.debugMode {
-			fmt.Printf("Saved raw response to %s\n", respFile)
-		}
+// parseOptions returns the response parsing settings from the client config
+func (c *Client) parseOptions() parseOptions {
+	return parseOptions{
+		lastWordPadMs:  c.config.LastWordPadMs,
+		lastWordCharMs: c.config.LastWordCharMs,
+		minDurationMs:  c.config.MinBlockDurationMs,
+		minCoverage:    c.config.MinBatchCoverage,
+		gapMs:          c.config.SubtitleGapMs,
+		modelTimings:   c.config.ModelTimings,
 	}
+}
 
-	// Check if the request was successful
-	if resp.StatusCode != http.StatusOK {
-		return nil, 0, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+// batchOverlap returns the number of context words resent before each batch
+func (c *Client) batchOverlap() int {
+	if c.config.GeminiBatchOverlap < 0 {
+		return 0
 	}
+	return c.config.GeminiBatchOverlap
+}
 
-	// Process the response
-	subtitles, lastWordIndex, err := parseBatchResponse(respBody, batch, startIndex)
-	if err != nil {
+// Helper function to parse the model's reply to a batch, returning its subtitles and
+// the index of the word the next batch starts at. Subtitles whose st_id is below
+// newFrom start in the overlap context and are dropped. Unless the batch is final,
+// a last subtitle marked incomplete, or whose last word can't be found, is carried
+// forward: it is dropped and the next batch starts at its first word, so that its
+// sentence is formed whole.
+func parseBatchResponse(content string, wordTimings []models.WordTiming, startIndex, newFrom int,
+	final bool, opts parseOptions) ([]models.Subtitle, int, error) {
+	// Clean up the JSON content to remove any markdown formatting or comments
+	jsonContent := cleanJsonContent(content)
+	if strings.TrimSpace(jsonContent) == "" {
+		return nil, 0, ErrEmptyResponse
+	}
+
+	// Parse the complete response object - using direct array instead of sentences property
+	var subtitleInputs []models.SubtitleInput
+	if err := json.Unmarshal([]byte(jsonContent), &subtitleInputs); err != nil {
+		return nil, 0, fmt.Errorf("%w: failed to parse JSON response: %w\nResponse was: %s",
+			ErrMalformedResponse, err, jsonContent)
+	}
+
+	// Make sure no words were dropped or reordered
+	if err := validateStartIndices(subtitleInputs, startIndex, len(wordTimings)); err != nil {
 		return nil, 0, err
 	}
 
-	// Debug: Log processed subtitles info
-	if c.debugMode {
-		fmt.Printf("Batch %d: Processed %d words into %d subtitles (last word index: %d)\n",
-			batchNum, len(batch), len(subtitles), lastWordIndex)
+	// Time the blocks by their source words rather than the timings the model copied
+	if !opts.modelTimings {
+		snapTimings(subtitleInputs, wordTimings)
+	}
 
-		// Save processed subtitles to file
-		if c.debugDir != "" {
-			subtitlesJSON, _ := json.MarshalIndent(subtitles, "", "  ")
-			subFile := filepath.Join(c.debugDir, fmt.Sprintf("batch_%d_subtitles.json", batchNum))
-			if err := os.WriteFile(subFile, subtitlesJSON, 0644); err != nil {
-				fmt.Printf("Warning: Failed to save debug subtitles: %v\n", err)
-			} else {
-				fmt.Printf("Saved processed subtitles to %s\n", subFile)
-			}
+	// Work out where the next batch starts: after the last subtitle's last word, or
+	// at its first word if the subtitle is carried forward
+	nextIndex := startIndex
+	carry := false
+	if len(subtitleInputs) > 0 {
+		last := subtitleInputs[len(subtitleInputs)-1]
+		lastWord, found := lastWordIndex(last, wordTimings, startIndex)
+		carry = !final && last.StartWordIndex > newFrom && (last.Incomplete || !found)
+		if found && !carry {
+			nextIndex = lastWord + 1
+		} else {
+			nextIndex = last.StartWordIndex
 		}
 	}
 
-	return subtitles, lastWordIndex, nil
-}
-
-// Helper function to build the prompt for a batch
-func buildBatchPrompt(wordTimings []models.WordTiming, isContinuation bool) string {
-	continueText := ""
-	if isContinuation {
-		continueText = `
-IMPORTANT: This is a continuation from a previous batch. 
-The first words may be from an incomplete sentence.
-Use the "id" field of each word as the absolute index in the transcript.
-The st_id values in your response should reference these absolute "id" values.
-If the first words continue a sentence from the previous batch, start with those words.
-DO NOT repeat sentence beginnings from previous batches, but continue them properly.
-`
-	}
-
-	prompt := `Convert these word-level transcript timings into subtitle blocks.
-Language: Thai, English (few words)
-Format: JSON object with sentences array where each element has:
-st_id (index of the first word in subtitle), st_ms (start time in milliseconds), 
-lw_ms (last word start time in milliseconds), and text (subtitle text).
-
-REQUIREMENTS:
-1. General formatting:
-   - Combine fragments into complete, grammatical sentences
-   - DO Fix spelling, spacing, punctuation and capitalization
-   - DO NOT add/remove any words
-   - DO NOT translate the content
-   - Natural length of sentences are 10-20 words
-   - Avoid long sentences with more than 30 words
-
-2. Subtitle structure:
-   - Each subtitle should form a complete, natural thought or sentence
-   - Each subtitle should end at a natural pause or break point
-   - Keep related phrases together in the same subtitle
-   - Each subtitle's st_ms must match the first word's start_ms exactly
-   - Each subtitle's lw_ms must match the last word's start_ms exactly
-   - Continue from the previous batch if this is a continuation
-
-3. Special handling:
-   - Look for natural sentence boundaries - DO NOT split mid-sentence
-   - Temperature readings (e.g., "อุณหภูมิต่ำสุด 22 องศา อุณหภูมิสูงสุด 39 องศา") must be in their own blocks
-   - For long lists (provinces, etc.), DO NOT split into multiple blocks, must be in their own blocks
-` + continueText + `   
-RETURN FORMAT:
-Return ONLY a clean JSON object with exactly this format:
-[{"st_id": 0,"st_ms": 123,"lw_ms": 456,"text": "Subtitle text here"},...]
-
-TRANSCRIPT DATA:
-`
-
-	wordTimingJSON, _ := json.MarshalIndent(wordTimings, "", "  ")
-	return prompt + string(wordTimingJSON)
-}
-
-// Helper function to parse the batch response
-func parseBatchResponse(respBody []byte, wordTimings []models.WordTiming, startIndex int) ([]models.Subtitle, int, error) {
-	var geminiResp Response
-	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
-		return nil, 0, fmt.Errorf("error parsing API response: %w", err)
+	// Make sure the response didn't skip most of the batch
+	if len(subtitleInputs) > 0 && len(wordTimings) > 0 {
+		coverage := batchCoverage(subtitleInputs, wordTimings)
+		slog.Debug("batch coverage", "coverage", coverage, "words", len(wordTimings))
+		if coverage < opts.minCoverage {
+			return nil, 0, fmt.Errorf("%w: %.0f%% of words covered, minimum is %.0f%%",
+				ErrLowCoverage, coverage*100, opts.minCoverage*100)
+		}
 	}
 
-	// Validate response structure
-	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return nil, 0, fmt.Errorf("no content in the API response")
+	// Drop blocks that start in the context words the previous batch already covered
+	kept := subtitleInputs[:0]
+	for _, sub := range subtitleInputs {
+		if sub.StartWordIndex >= newFrom {
+			kept = append(kept, sub)
+		}
 	}
 
-	// Get the JSON content
-	jsonContent := geminiResp.Candidates[0].Content.Parts[0].Text
+	subtitles := processSubtitles(kept, wordTimings, opts)
+	if carry && len(subtitles) > 0 {
+		slog.Debug("carrying unfinished subtitle into the next batch", "first_word", nextIndex)
+		subtitles = subtitles[:len(subtitles)-1]
+	}
+	return subtitles, nextIndex, nil
+}
 
-	// Clean up the JSON content to remove any markdown formatting or comments
-	jsonContent = cleanJsonContent(jsonContent)
+// Helper function to find the global index of a subtitle's last word: the last word
+// from its st_id on that starts at its lw_ms. startIndex is the global index of
+// wordTimings[0].
+func lastWordIndex(sub models.SubtitleInput, wordTimings []models.WordTiming, startIndex int) (int, bool) {
+	index, found := 0, false
+	for i := max(sub.StartWordIndex-startIndex, 0); i < len(wordTimings); i++ {
+		if wordTimings[i].StartTime > sub.LastWordStartMs {
+			break
+		}
+		if wordTimings[i].StartTime == sub.LastWordStartMs {
+			index, found = startIndex+i, true
+		}
+	}
+	return index, found
+}
 
-	// Parse the complete response object - using direct array instead of sentences property
-	var subtitleInputs []models.SubtitleInput
-	if err := json.Unmarshal([]byte(jsonContent), &subtitleInputs); err != nil {
-		return nil, 0, fmt.Errorf("failed to parse JSON response: %w\nResponse was: %s", err, jsonContent)
+// Helper function to check that every subtitle's st_id lies within the batch's
+// global index range [startIndex, startIndex+batchLen) and that they strictly increase
+func validateStartIndices(inputs []models.SubtitleInput, startIndex, batchLen int) error {
+	endIndex := startIndex + batchLen
+	for i, sub := range inputs {
+		if sub.StartWordIndex < startIndex || sub.StartWordIndex >= endIndex {
+			return fmt.Errorf("%w: subtitle %d has st_id %d outside the batch range [%d, %d)",
+				ErrInvalidIndices, i, sub.StartWordIndex, startIndex, endIndex)
+		}
+		if i > 0 && sub.StartWordIndex <= inputs[i-1].StartWordIndex {
+			return fmt.Errorf("%w: subtitle %d has st_id %d, not after the previous st_id %d",
+				ErrInvalidIndices, i, sub.StartWordIndex, inputs[i-1].StartWordIndex)
+		}
 	}
+	return nil
+}
 
-	// Calculate the last word index processed in this batch
-	var lastWordIndex int
-	if len(subtitleInputs) > 0 {
-		// Get StartWordIndex of the last subtitle in the batch
-		lastWordIndex = subtitleInputs[len(subtitleInputs)-1].StartWordIndex
-	} else {
-		// If no sentences were returned, assume all words in the batch were processed
-		lastWordIndex = startIndex
+// Helper function to calculate the fraction of a batch's words, counted from the
+// start of the batch, that the response's subtitles span
+func batchCoverage(inputs []models.SubtitleInput, wordTimings []models.WordTiming) float64 {
+	last := inputs[len(inputs)-1]
+
+	// Find the last word of the final subtitle, falling back to its first word
+	lastIndex := -1
+	for i := len(wordTimings) - 1; i >= 0; i-- {
+		if wordTimings[i].StartTime == last.LastWordStartMs {
+			lastIndex = i
+			break
+		}
+	}
+	if lastIndex == -1 {
+		for i, word := range wordTimings {
+			if word.ID == last.StartWordIndex {
+				lastIndex = i
+				break
+			}
+		}
 	}
 
-	return processSubtitles(subtitleInputs), lastWordIndex, nil
+	return float64(lastIndex+1) / float64(len(wordTimings))
 }
 
 // Helper function to clean JSON content from API response
@@ -335,36 +970,98 @@ func cleanJsonContent(jsonContent string) string {
 	return strings.TrimSpace(jsonContent)
 }
 
-// Helper function to process subtitles and calculate end times
-func processSubtitles(inputSubtitles []models.SubtitleInput) []models.Subtitle {
+// Helper function to process subtitles and calculate their end times and source words
+func processSubtitles(inputSubtitles []models.SubtitleInput, wordTimings []models.WordTiming, opts parseOptions) []models.Subtitle {
 	var subtitles []models.Subtitle
 	for i, sub := range inputSubtitles {
 		endMs := 0
 
 		// If we have last_word_start_ms information, use it to estimate display duration
 		if sub.LastWordStartMs > 0 {
-			// Add a reasonable display duration for the last word (about 1500ms)
-			endMs = sub.LastWordStartMs + 1500
+			lastWord, found := findLastWord(sub, wordTimings)
+			if found && lastWord.DurationMs > 0 {
+				// The source tells us exactly how long the last word is spoken
+				endMs = sub.LastWordStartMs + lastWord.DurationMs
+			} else {
+				// Pad the last word, giving longer words more time on screen
+				text := lastWord.Word
+				if !found {
+					text = lastToken(sub.Text)
+				}
+				charPad := int(opts.lastWordCharMs * float64(utf8.RuneCountInString(text)))
+				endMs = sub.LastWordStartMs + opts.lastWordPadMs + charPad
+			}
 		}
 
 		// If this is not the last subtitle, adjust end time based on next subtitle
 		if i < len(inputSubtitles)-1 {
-			nextStart := inputSubtitles[i+1].StartMs - 100 // 100ms gap between subtitles
+			nextStart := inputSubtitles[i+1].StartMs - opts.gapMs
 			if endMs == 0 || nextStart < endMs {
 				endMs = nextStart
 			}
 		}
 
 		// If endMs is still 0 or too close to start time, set a minimum duration
-		if endMs <= sub.StartMs || endMs-sub.StartMs < 1000 {
-			endMs = sub.StartMs + 1000 // Minimum 1 second display
+		if endMs <= sub.StartMs || endMs-sub.StartMs < opts.minDurationMs {
+			endMs = sub.StartMs + max(opts.minDurationMs, 1)
 		}
 
 		subtitles = append(subtitles, models.Subtitle{
-			StartMs: sub.StartMs,
-			EndMs:   endMs,
-			Text:    sub.Text,
+			StartMs:   sub.StartMs,
+			EndMs:     endMs,
+			Text:      sub.Text,
+			Position:  findPosition(sub, wordTimings),
+			FirstWord: sub.StartWordIndex,
+			WordCount: blockWordCount(inputSubtitles, i, wordTimings),
 		})
 	}
 	return subtitles
 }
+
+// Helper function to count the source words of subtitle i: the words up to the next
+// subtitle's st_id, or for the last subtitle, up to its last word or else the end
+// of wordTimings
+func blockWordCount(inputSubtitles []models.SubtitleInput, i int, wordTimings []models.WordTiming) int {
+	sub := inputSubtitles[i]
+	if i+1 < len(inputSubtitles) {
+		return inputSubtitles[i+1].StartWordIndex - sub.StartWordIndex
+	}
+	if len(wordTimings) == 0 {
+		return 0
+	}
+	firstID := wordTimings[0].ID
+	end := firstID + len(wordTimings)
+	if last, found := lastWordIndex(sub, wordTimings, firstID); found {
+		end = last + 1
+	}
+	return max(end-sub.StartWordIndex, 0)
+}
+
+// Helper function to find the source word that starts at a subtitle's lw_ms
+func findLastWord(sub models.SubtitleInput, wordTimings []models.WordTiming) (models.WordTiming, bool) {
+	for i := len(wordTimings) - 1; i >= 0; i-- {
+		if wordTimings[i].StartTime == sub.LastWordStartMs {
+			return wordTimings[i], true
+		}
+	}
+	return models.WordTiming{}, false
+}
+
+// Helper function to get the last space-separated token of a text
+func lastToken(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// Helper function to find the source caption position of a subtitle's first word
+func findPosition(sub models.SubtitleInput, wordTimings []models.WordTiming) *models.Position {
+	for _, word := range wordTimings {
+		if word.ID == sub.StartWordIndex {
+			return word.Position
+		}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"yt_enhancer/pkg/config"
+	"yt_enhancer/pkg/models"
+)
+
+// newTestConfig returns the default configuration with a placeholder API key and
+// the response cache off
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	t.Setenv("GEMINI_API_KEY", "test-key")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+	cfg.GeminiCacheDir = ""
+	return cfg
+}
+
+// newTestServer starts a stand-in for the Gemini API that answers each request
+// with the model text reply returns for its prompt
+func newTestServer(t *testing.T, reply func(prompt string) string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Contents []struct {
+				Parts []Part `json:"parts"`
+			} `json:"contents"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Contents) == 0 || len(req.Contents[0].Parts) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		var resp Response
+		resp.Candidates = make([]Candidate, 1)
+		resp.Candidates[0].Content.Parts = []Part{{Text: reply(req.Contents[0].Parts[0].Text)}}
+		resp.Candidates[0].FinishReason = "STOP"
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestClient returns a client for cfg that sends its requests to srv
+func newTestClient(cfg *config.Config, srv *httptest.Server) *Client {
+	client := NewClient(cfg)
+	client.SetBaseURL(srv.URL)
+	return client
+}
+
+// cannedReply returns a reply function that always answers with blocks
+func cannedReply(blocks []models.SubtitleInput) func(string) string {
+	data, _ := json.Marshal(blocks)
+	return func(string) string { return string(data) }
+}
+
+func TestCreateSubtitlesWithRecordedResponse(t *testing.T) {
+	reply := []models.SubtitleInput{
+		{StartWordIndex: 0, StartMs: 0, LastWordStartMs: 400, Text: "Hello world."},
+		{StartWordIndex: 2, StartMs: 1200, LastWordStartMs: 1500, Text: "This is fine."},
+	}
+
+	tests := []struct {
+		name           string
+		lastDurationMs int // How long the source says the last word is spoken
+		want           []models.Subtitle
+	}{
+		{
+			// The first block's padded end is trimmed to keep the 100ms gap
+			// before the next block; the last gets LastWordPadMs
+			name: "padded last word",
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 1100, Text: "Hello world.", FirstWord: 0, WordCount: 2},
+				{StartMs: 1200, EndMs: 3000, Text: "This is fine.", FirstWord: 2, WordCount: 3},
+			},
+		},
+		{
+			name:           "source word duration",
+			lastDurationMs: 700,
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 1100, Text: "Hello world.", FirstWord: 0, WordCount: 2},
+				{StartMs: 1200, EndMs: 2200, Text: "This is fine.", FirstWord: 2, WordCount: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			words := []models.WordTiming{
+				{ID: 0, Word: "Hello", StartTime: 0},
+				{ID: 1, Word: "world.", StartTime: 400},
+				{ID: 2, Word: "This", StartTime: 1200},
+				{ID: 3, Word: "is", StartTime: 1400},
+				{ID: 4, Word: "fine.", StartTime: 1500, DurationMs: tt.lastDurationMs},
+			}
+			srv := newTestServer(t, cannedReply(reply))
+			client := newTestClient(newTestConfig(t), srv)
+
+			got, err := client.CreateSubtitles(context.Background(), words)
+			if err != nil {
+				t.Fatalf("CreateSubtitles: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateSubtitles =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBatchResponseCarry(t *testing.T) {
+	words := make([]models.WordTiming, 6)
+	for i := range words {
+		words[i] = models.WordTiming{ID: i, Word: fmt.Sprintf("w%d", i), StartTime: i * 500}
+	}
+	tests := []struct {
+		name         string
+		reply        []models.SubtitleInput
+		final        bool
+		modelTimings bool // Keep the model's lw_ms rather than snapping it to a source word
+		wantTexts    []string
+		wantNext     int
+	}{
+		{
+			name: "incomplete last block is carried",
+			reply: []models.SubtitleInput{
+				{StartWordIndex: 0, StartMs: 0, LastWordStartMs: 1000, Text: "a"},
+				{StartWordIndex: 3, StartMs: 1500, LastWordStartMs: 2500, Text: "b", Incomplete: true},
+			},
+			wantTexts: []string{"a"},
+			wantNext:  3,
+		},
+		{
+			name: "last block ending past the batch is carried",
+			reply: []models.SubtitleInput{
+				{StartWordIndex: 0, StartMs: 0, LastWordStartMs: 1000, Text: "a"},
+				{StartWordIndex: 3, StartMs: 1500, LastWordStartMs: 9000, Text: "b"},
+			},
+			modelTimings: true,
+			wantTexts:    []string{"a"},
+			wantNext:     3,
+		},
+		{
+			name: "final batch keeps its incomplete block",
+			reply: []models.SubtitleInput{
+				{StartWordIndex: 0, StartMs: 0, LastWordStartMs: 1000, Text: "a"},
+				{StartWordIndex: 3, StartMs: 1500, LastWordStartMs: 2500, Text: "b", Incomplete: true},
+			},
+			final:     true,
+			wantTexts: []string{"a", "b"},
+			wantNext:  6,
+		},
+		{
+			// Carrying the batch's only block would never advance
+			name: "sole block is kept",
+			reply: []models.SubtitleInput{
+				{StartWordIndex: 0, StartMs: 0, LastWordStartMs: 2500, Text: "a", Incomplete: true},
+			},
+			wantTexts: []string{"a"},
+			wantNext:  6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := parseOptions{lastWordPadMs: 1500, minDurationMs: 1000, gapMs: 100, modelTimings: tt.modelTimings}
+			data, _ := json.Marshal(tt.reply)
+			subs, next, err := parseBatchResponse(string(data), words, 0, 0, tt.final, opts)
+			if err != nil {
+				t.Fatalf("parseBatchResponse: %v", err)
+			}
+			var texts []string
+			for _, sub := range subs {
+				texts = append(texts, sub.Text)
+			}
+			if !reflect.DeepEqual(texts, tt.wantTexts) || next != tt.wantNext {
+				t.Errorf("parseBatchResponse = %q, next %d; want %q, next %d", texts, next, tt.wantTexts, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestCreateSubtitlesCarriesIncompleteBlock(t *testing.T) {
+	texts := strings.Fields("One two. three four five six. seven eight.")
+	words := make([]models.WordTiming, len(texts))
+	for i, text := range texts {
+		words[i] = models.WordTiming{ID: i, Word: text, StartTime: i * 500}
+	}
+
+	// Replies by the global index of each batch's first word. The first batch
+	// breaks off mid-sentence, so the second must start at word 2 again.
+	replies := map[int][]models.SubtitleInput{
+		0: {
+			{StartWordIndex: 0, StartMs: 0, LastWordStartMs: 500, Text: "One two."},
+			{StartWordIndex: 2, StartMs: 1000, LastWordStartMs: 1500, Text: "three four", Incomplete: true},
+		},
+		2: {{StartWordIndex: 2, StartMs: 1000, LastWordStartMs: 2500, Text: "three four five six."}},
+		6: {{StartWordIndex: 6, StartMs: 3000, LastWordStartMs: 3500, Text: "seven eight."}},
+	}
+	startPattern := regexp.MustCompile(`start at global index (\d+)`)
+	var mu sync.Mutex
+	var starts []int
+	srv := newTestServer(t, func(prompt string) string {
+		start := 0
+		if m := startPattern.FindStringSubmatch(prompt); m != nil {
+			start, _ = strconv.Atoi(m[1])
+		}
+		mu.Lock()
+		starts = append(starts, start)
+		mu.Unlock()
+		return cannedReply(replies[start])(prompt)
+	})
+
+	cfg := newTestConfig(t)
+	cfg.GeminiBatchSize = 4
+	client := newTestClient(cfg, srv)
+
+	got, err := client.CreateSubtitles(context.Background(), words)
+	if err != nil {
+		t.Fatalf("CreateSubtitles: %v", err)
+	}
+	want := []models.Subtitle{
+		{StartMs: 0, EndMs: 900, Text: "One two.", FirstWord: 0, WordCount: 2},
+		{StartMs: 1000, EndMs: 2900, Text: "three four five six.", FirstWord: 2, WordCount: 4},
+		{StartMs: 3000, EndMs: 5000, Text: "seven eight.", FirstWord: 6, WordCount: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CreateSubtitles =\n%+v\nwant\n%+v", got, want)
+	}
+	if wantStarts := []int{0, 2, 6}; !reflect.DeepEqual(starts, wantStarts) {
+		t.Errorf("batches started at words %v, want %v", starts, wantStarts)
+	}
+}
+
+func TestProcessSubtitlesLastWordPad(t *testing.T) {
+	words := []models.WordTiming{
+		{ID: 0, Word: "Hi", StartTime: 1500},
+		{ID: 1, Word: "extraordinary", StartTime: 2000},
+		{ID: 2, Word: "so", StartTime: 5000},
+		{ID: 3, Word: "ok", StartTime: 6000},
+	}
+	inputs := []models.SubtitleInput{
+		{StartWordIndex: 0, StartMs: 1500, LastWordStartMs: 2000, Text: "Hi extraordinary"},
+		{StartWordIndex: 2, StartMs: 5000, LastWordStartMs: 6000, Text: "so ok"},
+	}
+
+	tests := []struct {
+		name string
+		opts parseOptions
+		want []int // End of each block
+	}{
+		{
+			name: "fixed pad",
+			opts: parseOptions{lastWordPadMs: 1500},
+			want: []int{3500, 7500},
+		},
+		{
+			name: "shorter pad",
+			opts: parseOptions{lastWordPadMs: 500},
+			want: []int{2500, 6500},
+		},
+		{
+			// 13 characters in "extraordinary", 2 in "ok"
+			name: "scaled by characters",
+			opts: parseOptions{lastWordPadMs: 500, lastWordCharMs: 100},
+			want: []int{3800, 6700},
+		},
+		{
+			name: "capped at the next block",
+			opts: parseOptions{lastWordPadMs: 500, lastWordCharMs: 400, gapMs: 100},
+			want: []int{4900, 7300},
+		},
+		{
+			name: "minimum duration",
+			opts: parseOptions{lastWordPadMs: 100, minDurationMs: 1000},
+			want: []int{2500, 6100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, sub := range processSubtitles(inputs, words, tt.opts) {
+				got = append(got, sub.EndMs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("block ends = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSubtitlesRetriesLowCoverage(t *testing.T) {
+	words := make([]models.WordTiming, 40)
+	for i := range words {
+		words[i] = models.WordTiming{ID: i, Word: fmt.Sprintf("w%d", i), StartTime: i * 500}
+	}
+	block := func(first, last int) models.SubtitleInput {
+		return models.SubtitleInput{StartWordIndex: first, StartMs: first * 500, LastWordStartMs: last * 500,
+			Text: fmt.Sprintf("words %d to %d", first, last)}
+	}
+
+	// The first reply covers 5 of the 40 words, so the batch is retried at half
+	// the size before going back to the full size
+	startPattern := regexp.MustCompile(`start at global index (\d+)`)
+	var mu sync.Mutex
+	var starts []int
+	srv := newTestServer(t, func(prompt string) string {
+		start := 0
+		if m := startPattern.FindStringSubmatch(prompt); m != nil {
+			start, _ = strconv.Atoi(m[1])
+		}
+		mu.Lock()
+		starts = append(starts, start)
+		calls := len(starts)
+		mu.Unlock()
+		switch {
+		case calls == 1:
+			return cannedReply([]models.SubtitleInput{block(0, 4)})(prompt)
+		case start == 0:
+			return cannedReply([]models.SubtitleInput{block(0, 19)})(prompt)
+		default:
+			return cannedReply([]models.SubtitleInput{block(20, 39)})(prompt)
+		}
+	})
+
+	cfg := newTestConfig(t)
+	cfg.GeminiBatchSize = 40
+	client := newTestClient(cfg, srv)
+
+	got, err := client.CreateSubtitles(context.Background(), words)
+	if err != nil {
+		t.Fatalf("CreateSubtitles: %v", err)
+	}
+	if len(got) != 2 || got[0].Text != "words 0 to 19" || got[1].Text != "words 20 to 39" {
+		t.Errorf("CreateSubtitles = %+v, want blocks for words 0 to 19 and 20 to 39", got)
+	}
+	if wantStarts := []int{0, 0, 20}; !reflect.DeepEqual(starts, wantStarts) {
+		t.Errorf("batches started at words %v, want %v", starts, wantStarts)
+	}
+	if retries := client.Usage().Retries; retries != 1 {
+		t.Errorf("got %d retries, want 1", retries)
+	}
+}
+
+func TestParseBatchResponseLowCoverage(t *testing.T) {
+	words := make([]models.WordTiming, 10)
+	for i := range words {
+		words[i] = models.WordTiming{ID: i, Word: fmt.Sprintf("w%d", i), StartTime: i * 500}
+	}
+	reply := `[{"st_id": 0, "st_ms": 0, "lw_ms": 1000, "text": "w0 w1 w2"}]`
+
+	tests := []struct {
+		name        string
+		minCoverage float64
+		wantErr     bool
+	}{
+		{name: "under the minimum", minCoverage: 0.5, wantErr: true},
+		{name: "at the minimum", minCoverage: 0.3},
+		{name: "check off", minCoverage: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseBatchResponse(reply, words, 0, 0, true, parseOptions{minCoverage: tt.minCoverage})
+			if errors.Is(err, ErrLowCoverage) != tt.wantErr {
+				t.Errorf("parseBatchResponse error = %v, want low coverage %v", err, tt.wantErr)
+			}
+		})
+	}
+}
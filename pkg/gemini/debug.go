@@ -0,0 +1,66 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// debugNameKey is the context key of the name debug files are prefixed with
+type debugNameKey struct{}
+
+// debugPrefixKey is the context key of the debug file prefix of the current run
+type debugPrefixKey struct{}
+
+// WithDebugName returns a context whose conversions name their debug files after
+// name, such as the input's base name, so that files from conversions sharing a
+// client and debug directory can be told apart
+func WithDebugName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, debugNameKey{}, filepath.Base(name))
+}
+
+// startDebugRun numbers a run of the client, creating the debug directory on the
+// first one, and returns a context naming the run's debug files like
+// name_run3_batch_1_prompt.txt, or run3_batch_1_prompt.txt without a debug name
+func (c *Client) startDebugRun(ctx context.Context) (context.Context, error) {
+	if !c.debugMode || c.debugDir == "" {
+		return ctx, nil
+	}
+
+	// Create the debug directory once, however many runs start at the same time
+	c.debugDirOnce.Do(func() {
+		if err := os.MkdirAll(c.debugDir, 0755); err != nil {
+			c.debugDirErr = fmt.Errorf("failed to create debug directory: %w", err)
+		}
+	})
+	if c.debugDirErr != nil {
+		return ctx, c.debugDirErr
+	}
+
+	prefix := fmt.Sprintf("run%d", c.debugRuns.Add(1))
+	if name, ok := ctx.Value(debugNameKey{}).(string); ok && name != "" {
+		prefix = name + "_" + prefix
+	}
+	return context.WithValue(ctx, debugPrefixKey{}, prefix), nil
+}
+
+// saveDebugFile writes data to a file in the debug directory when debug mode is on,
+// prefixing name with the run ctx belongs to. kind describes the content in the log
+// message.
+func (c *Client) saveDebugFile(ctx context.Context, name, kind string, batchNum int, data []byte) {
+	if !c.debugMode || c.debugDir == "" {
+		return
+	}
+
+	if prefix, ok := ctx.Value(debugPrefixKey{}).(string); ok {
+		name = prefix + "_" + name
+	}
+	path := filepath.Join(c.debugDir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		slog.Warn("failed to save debug "+kind, "path", path, "error", err)
+		return
+	}
+	slog.Debug("saved debug "+kind, "batch", batchNum, "path", path)
+}
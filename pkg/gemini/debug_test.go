@@ -0,0 +1,61 @@
+package gemini
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"yt_enhancer/pkg/models"
+)
+
+func TestDebugFilesOfConcurrentRuns(t *testing.T) {
+	words := []models.WordTiming{
+		{ID: 0, Word: "Hello", StartTime: 0},
+		{ID: 1, Word: "world.", StartTime: 400},
+	}
+	srv := newTestServer(t, cannedReply([]models.SubtitleInput{
+		{StartWordIndex: 0, StartMs: 0, LastWordStartMs: 400, Text: "Hello world."},
+	}))
+	cfg := newTestConfig(t)
+	cfg.DebugMode = true
+	cfg.DebugDir = t.TempDir()
+	client := newTestClient(cfg, srv)
+
+	// Runs with the same input name, and runs with none, share the client
+	const runs = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.Background()
+			if i%2 == 0 {
+				ctx = WithDebugName(ctx, "/videos/talk.srv3")
+			}
+			_, err := client.CreateSubtitles(ctx, words)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("CreateSubtitles: %v", err)
+		}
+	}
+
+	// Each run saves its prompt, response and subtitles for its single batch
+	entries, err := os.ReadDir(cfg.DebugDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != runs*3 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("got %d debug files, want %d: %q", len(entries), runs*3, names)
+	}
+}
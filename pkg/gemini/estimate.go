@@ -0,0 +1,73 @@
+package gemini
+
+import (
+	"unicode/utf8"
+
+	"yt_enhancer/pkg/models"
+)
+
+const (
+	// charsPerToken is the rough number of characters per token used for estimates
+	charsPerToken = 4
+	// estimatedWordsPerBlock is the typical number of words in a generated subtitle
+	estimatedWordsPerBlock = 8
+	// blockOverheadTokens approximates the JSON fields around each block's text
+	blockOverheadTokens = 20
+)
+
+// BatchEstimate is a rough forecast of the API usage needed to process a transcript
+type BatchEstimate struct {
+	Batches              int
+	PromptTokensPerBatch []int
+	PromptTokens         int
+	OutputTokens         int
+	TotalTokens          int
+}
+
+// EstimateBatches forecasts the number of batches and tokens CreateSubtitles would
+// use for wordTimings without calling the API. Tokens are estimated at one per four
+// characters. The batch count is a lower bound: batches that continue from the
+// previous one's last subtitle, or that are retried, add a few more calls.
+func (c *Client) EstimateBatches(wordTimings []models.WordTiming) BatchEstimate {
+	var estimate BatchEstimate
+
+	// Estimate with the built-in prompt if the custom one can't be used
+	tmpl, err := c.promptTemplate()
+	if err != nil {
+		tmpl = defaultPrompt
+	}
+
+	for start := 0; start < len(wordTimings); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(wordTimings) {
+			end = len(wordTimings)
+		}
+		contextStart := start - c.batchOverlap()
+		if contextStart < 0 {
+			contextStart = 0
+		}
+		batch := wordTimings[contextStart:end]
+
+		prompt, _ := buildBatchPrompt(tmpl, batch, contextStart, c.languageLine(""))
+		promptTokens := estimateTokens(prompt)
+		estimate.Batches++
+		estimate.PromptTokensPerBatch = append(estimate.PromptTokensPerBatch, promptTokens)
+		estimate.PromptTokens += promptTokens
+
+		// The response repeats the new words' text, plus a little JSON per block
+		textChars := 0
+		for _, word := range wordTimings[start:end] {
+			textChars += utf8.RuneCountInString(word.Word)
+		}
+		blocks := (end - start + estimatedWordsPerBlock - 1) / estimatedWordsPerBlock
+		estimate.OutputTokens += textChars/charsPerToken + blocks*blockOverheadTokens
+	}
+
+	estimate.TotalTokens = estimate.PromptTokens + estimate.OutputTokens
+	return estimate
+}
+
+// estimateTokens approximates the token count of text
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
@@ -0,0 +1,56 @@
+package gemini
+
+import "strings"
+
+// defaultLanguage is the prompt's Language line when no language is given
+const defaultLanguage = "Thai, English (few words)"
+
+// languageNames maps subtitle language codes to the names used in the prompt
+var languageNames = map[string]string{
+	"th": "Thai",
+	"en": "English",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"zh": "Chinese",
+	"vi": "Vietnamese",
+	"id": "Indonesian",
+	"ms": "Malay",
+	"lo": "Lao",
+	"km": "Khmer",
+	"my": "Burmese",
+	"fr": "French",
+	"de": "German",
+	"es": "Spanish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"hi": "Hindi",
+}
+
+// promptLanguage returns the prompt's Language line for a language code such as
+// "en" or "zh-Hans". Thai transcripts keep the default line, since they often
+// contain a few English words.
+func promptLanguage(lang string) string {
+	if lang == "" || languageName(lang) == "Thai" {
+		return defaultLanguage
+	}
+	return languageName(lang)
+}
+
+// languageLine returns the prompt's Language line for a language code, or
+// LANGUAGE_HINT if it is set
+func (c *Client) languageLine(lang string) string {
+	if c.config.LanguageHint != "" {
+		return c.config.LanguageHint
+	}
+	return promptLanguage(lang)
+}
+
+// languageName returns the English name of a language code. Unknown codes are
+// returned as is.
+func languageName(lang string) string {
+	base := strings.ToLower(strings.SplitN(lang, "-", 2)[0])
+	if name, ok := languageNames[base]; ok {
+		return name
+	}
+	return lang
+}
@@ -0,0 +1,53 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"yt_enhancer/pkg/llm"
+)
+
+// Metrics receives measurements of a Client's API calls, e.g. to feed Prometheus
+// or StatsD. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveRequest is called after each request for subtitles or translations
+	// with how long it took and its outcome: "ok", the HTTP status code of a
+	// failed request such as "429", "timeout", "canceled" or "error"
+	ObserveRequest(duration time.Duration, status string)
+
+	// ObserveTokens is called with the token counts the backend reports for a
+	// request, taken from Gemini's usageMetadata or the provider's usage fields
+	ObserveTokens(promptTokens, outputTokens int)
+
+	// ObserveRetry is called when a batch is requested again, with the reason:
+	// "low_coverage", "truncated" or "malformed", when it is split into smaller
+	// batches, or "invalid_indices", when the same batch is sent once more
+	ObserveRetry(reason string)
+}
+
+// observeRequest reports a request started at start that ended with err. ctx is
+// the context of the run, used to tell a request timeout from a cancelled run.
+func (c *Client) observeRequest(ctx context.Context, start time.Time, err error) {
+	if c.Metrics != nil {
+		c.Metrics.ObserveRequest(time.Since(start), requestStatus(ctx, err))
+	}
+}
+
+// requestStatus describes the outcome of a request for metrics
+func requestStatus(ctx context.Context, err error) string {
+	var statusErr *llm.StatusError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &statusErr):
+		return strconv.Itoa(statusErr.StatusCode)
+	case ctx.Err() != nil:
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
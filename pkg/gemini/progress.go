@@ -0,0 +1,75 @@
+package gemini
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"yt_enhancer/pkg/models"
+)
+
+// ProgressFunc is called at the start and end of each batch with the batch number,
+// the expected number of batches, and how many of the transcript's words are done.
+// The batch total is estimated from the batch size and grows if the model stops
+// batches early.
+type ProgressFunc func(batchNum, totalBatches, wordsDone, wordsTotal int)
+
+// runProgress numbers the batches of one run and reports its progress. It is
+// safe for concurrent use, and calls to the callback never overlap.
+type runProgress struct {
+	batches    atomic.Int64
+	mu         sync.Mutex
+	report     ProgressFunc
+	onSubtitle func(models.Subtitle)
+	total      int
+	wordsDone  int
+	wordsTotal int
+}
+
+// newRunProgress creates the progress of a run over the given word ranges
+func newRunProgress(report ProgressFunc, ranges [][2]int, batchSize int) *runProgress {
+	p := &runProgress{report: report}
+	for _, r := range ranges {
+		words := r[1] - r[0]
+		p.wordsTotal += words
+		p.total += (words + batchSize - 1) / batchSize
+	}
+	return p
+}
+
+// nextBatch returns the number of the next batch
+func (p *runProgress) nextBatch() int {
+	return int(p.batches.Add(1))
+}
+
+// startBatch reports that batch batchNum is being sent
+func (p *runProgress) startBatch(batchNum int) {
+	p.finishBatch(batchNum, 0)
+}
+
+// finishBatch records words as done and reports the progress after batch batchNum
+func (p *runProgress) finishBatch(batchNum, words int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.wordsDone += words
+	if p.report == nil {
+		return
+	}
+	p.total = max(p.total, int(p.batches.Load()))
+	p.report(batchNum, p.total, p.wordsDone, p.wordsTotal)
+}
+
+// streaming reports whether finished subtitle blocks are reported as they arrive
+func (p *runProgress) streaming() bool {
+	return p.onSubtitle != nil
+}
+
+// emit reports a finished subtitle block
+func (p *runProgress) emit(sub models.Subtitle) {
+	if p.onSubtitle == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onSubtitle(sub)
+}
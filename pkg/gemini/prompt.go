@@ -0,0 +1,134 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+
+	"yt_enhancer/pkg/models"
+)
+
+// defaultPromptTemplate is the built-in batch prompt, used unless GEMINI_PROMPT_FILE
+// names a replacement. It is tuned for Thai news transcripts.
+const defaultPromptTemplate = `Convert these word-level transcript timings into subtitle blocks.
+Language: {{.Language}}
+Format: JSON object with sentences array where each element has:
+st_id (index of the first word in subtitle), st_ms (start time in milliseconds), 
+lw_ms (last word start time in milliseconds), and text (subtitle text).
+
+REQUIREMENTS:
+1. General formatting:
+   - Combine fragments into complete, grammatical sentences
+   - DO Fix spelling, spacing, punctuation and capitalization
+   - DO NOT add/remove any words
+   - DO NOT translate the content
+   - Keep inline tags such as <i> and </i> around the same words
+   - Natural length of sentences are 10-20 words
+   - Avoid long sentences with more than 30 words
+
+2. Subtitle structure:
+   - Each subtitle should form a complete, natural thought or sentence
+   - Each subtitle should end at a natural pause or break point
+   - Keep related phrases together in the same subtitle
+   - Each subtitle's st_ms must match the first word's start_ms exactly
+   - Each subtitle's lw_ms must match the last word's start_ms exactly
+   - Continue from the previous batch if this is a continuation
+   - If the last subtitle's sentence is cut off by the end of the words, add "incomplete": true to it
+
+3. Special handling:
+   - Look for natural sentence boundaries - DO NOT split mid-sentence
+   - Temperature readings (e.g., "อุณหภูมิต่ำสุด 22 องศา อุณหภูมิสูงสุด 39 องศา") must be in their own blocks
+   - For long lists (provinces, etc.), DO NOT split into multiple blocks, must be in their own blocks
+{{- if .Uncertain}}
+   - Words marked "uncertain": true were poorly recognized; correct one only if the surrounding words make the intended word clear
+{{- end}}
+{{if .Continuation}}
+IMPORTANT: This is a continuation from a previous batch. 
+The first words may be from an incomplete sentence.
+Use the "id" field of each word as the absolute index in the transcript.
+The st_id values in your response should reference these absolute "id" values.
+If the first words continue a sentence from the previous batch, start with those words.
+DO NOT repeat sentence beginnings from previous batches, but continue them properly.
+{{end}}   
+RETURN FORMAT:
+Return ONLY a clean JSON object with exactly this format:
+[{"st_id": 0,"st_ms": 123,"lw_ms": 456,"text": "Subtitle text here"},...]
+
+TRANSCRIPT DATA:{{if .StartIndex}}
+IMPORTANT: These words start at global index {{.StartIndex}} in the full transcript.
+{{end}}
+{{.TranscriptJSON}}`
+
+// defaultPrompt is the parsed built-in batch prompt
+var defaultPrompt = template.Must(template.New("prompt").Parse(defaultPromptTemplate))
+
+// promptData holds the values available to a batch prompt template
+type promptData struct {
+	Language       string // English name of the transcript language, e.g. Thai
+	Continuation   bool   // Whether the batch continues from a previous one
+	StartIndex     int    // Global index of the batch's first word
+	WordCount      int    // Number of words in the batch
+	Uncertain      bool   // Whether any word of the batch is marked uncertain
+	TranscriptJSON string // The batch's word timings as an indented JSON array
+}
+
+// loadPromptTemplate parses the batch prompt template in path, or returns the
+// built-in prompt if path is empty. The template is tried on sample data so that
+// mistakes such as unknown fields are reported before any batch is sent.
+func loadPromptTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return defaultPrompt, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompt file: %w", err)
+	}
+	tmpl, err := template.New(path).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing prompt file: %w", err)
+	}
+	sample := promptData{Language: defaultLanguage, Continuation: true, StartIndex: 1, WordCount: 1, Uncertain: true, TranscriptJSON: "[]"}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("error in prompt file: %w", err)
+	}
+	return tmpl, nil
+}
+
+// promptTemplate returns the batch prompt template, loading GEMINI_PROMPT_FILE the
+// first time it is needed
+func (c *Client) promptTemplate() (*template.Template, error) {
+	c.promptOnce.Do(func() {
+		c.prompt, c.promptErr = loadPromptTemplate(c.config.GeminiPromptFile)
+	})
+	return c.prompt, c.promptErr
+}
+
+// buildBatchPrompt builds the prompt for a batch of words starting at global index
+// startIndex, with languageLine as its Language line. Batches after the first are
+// marked as continuations.
+func buildBatchPrompt(tmpl *template.Template, wordTimings []models.WordTiming, startIndex int, languageLine string) (string, error) {
+	wordTimingJSON, _ := json.MarshalIndent(wordTimings, "", "  ")
+
+	uncertain := false
+	for _, word := range wordTimings {
+		uncertain = uncertain || word.Uncertain
+	}
+
+	var prompt bytes.Buffer
+	err := tmpl.Execute(&prompt, promptData{
+		Language:       languageLine,
+		Continuation:   startIndex > 0,
+		StartIndex:     startIndex,
+		WordCount:      len(wordTimings),
+		Uncertain:      uncertain,
+		TranscriptJSON: string(wordTimingJSON),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error building prompt: %w", err)
+	}
+	return prompt.String(), nil
+}
@@ -0,0 +1,51 @@
+package gemini
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces out API requests so that no more than a fixed number are
+// started per minute. It is safe for concurrent use.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter creates a limiter allowing requestsPerMinute requests per minute.
+// A value of zero or less disables limiting and returns nil.
+func newRateLimiter(requestsPerMinute int) *rateLimiter {
+	if requestsPerMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Minute / time.Duration(requestsPerMinute)}
+}
+
+// wait blocks until the next request is allowed or ctx is done. It is a no-op on
+// a nil limiter.
+func (r *rateLimiter) wait(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	start := r.next
+	if start.Before(now) {
+		start = now
+	}
+	r.next = start.Add(r.interval)
+	r.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,95 @@
+package gemini
+
+import (
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"yt_enhancer/pkg/models"
+)
+
+// minRepeatedWords is the fewest leading words of a block that are removed as a
+// repeat of the previous block, so a word genuinely said twice is kept
+const minRepeatedWords = 2
+
+// dedupeSeam removes a repeat of prev, the last block before a batch, from the
+// start of the batch's blocks. Blocks starting in the batch's context words are
+// already dropped by their st_id, but despite the prompt the model sometimes gives
+// the first new word's st_id to a block that re-emits the previous batch's last
+// sentence. A first block starting where prev's words end is dropped if it has
+// prev's text, and loses its leading words if they repeat the end of prev.
+func dedupeSeam(prev models.Subtitle, next []models.Subtitle) []models.Subtitle {
+	if len(next) == 0 || !atSeam(prev, next[0]) {
+		return next
+	}
+
+	first := next[0]
+	if seamKey(first.Text) == seamKey(prev.Text) {
+		slog.Warn("dropping block repeating the previous batch", "start_ms", first.StartMs, "text", first.Text)
+		return next[1:]
+	}
+
+	if rest, ok := trimRepeat(prev.Text, first.Text); ok {
+		slog.Warn("removing words repeating the previous batch", "start_ms", first.StartMs,
+			"text", first.Text, "kept", rest)
+		next[0].Text = rest
+	}
+	return next
+}
+
+// atSeam reports whether first could repeat prev: it starts within prev's source
+// words or at the word right after them. Blocks without a word range, such as
+// those resumed from a checkpoint, have to start before prev ends instead.
+func atSeam(prev, first models.Subtitle) bool {
+	if prev.WordCount > 0 && first.WordCount > 0 {
+		return first.FirstWord <= prev.FirstWord+prev.WordCount
+	}
+	return first.StartMs < prev.EndMs
+}
+
+// trimRepeat returns text without its leading words that repeat the end of prev,
+// or false if it doesn't start with at least minRepeatedWords of them. In scripts
+// written without spaces, a text starting with all of prev loses that whole
+// prefix; in others the repeat has to end at a space, so "Nobody" doesn't lose
+// the "No" before it.
+func trimRepeat(prev, text string) (string, bool) {
+	prev, text = strings.TrimSpace(prev), strings.TrimSpace(text)
+	if prev != "" && len(text) > len(prev) && strings.HasPrefix(text, prev) {
+		last, _ := utf8.DecodeLastRuneInString(prev)
+		next, _ := utf8.DecodeRuneInString(text[len(prev):])
+		if isUnspaced(last) || isUnspaced(next) {
+			return strings.TrimSpace(text[len(prev):]), true
+		}
+	}
+
+	prevWords, words := strings.Fields(prev), strings.Fields(text)
+	for n := min(len(prevWords), len(words)-1); n >= minRepeatedWords; n-- {
+		if seamKey(strings.Join(prevWords[len(prevWords)-n:], " ")) == seamKey(strings.Join(words[:n], " ")) {
+			return strings.Join(words[n:], " "), true
+		}
+	}
+	return "", false
+}
+
+// unspacedScripts are scripts written without spaces between words
+var unspacedScripts = []*unicode.RangeTable{
+	unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar,
+	unicode.Han, unicode.Hiragana, unicode.Katakana,
+}
+
+// isUnspaced reports whether r belongs to a script written without spaces
+func isUnspaced(r rune) bool {
+	return unicode.In(r, unspacedScripts...)
+}
+
+// seamKey normalizes text for comparing blocks, ignoring case, spacing and
+// punctuation
+func seamKey(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
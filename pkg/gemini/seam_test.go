@@ -0,0 +1,134 @@
+package gemini
+
+import (
+	"reflect"
+	"testing"
+
+	"yt_enhancer/pkg/models"
+)
+
+func TestDedupeSeam(t *testing.T) {
+	prev := models.Subtitle{StartMs: 0, EndMs: 2000, Text: "We went to the park."}
+	ranged := models.Subtitle{StartMs: 0, EndMs: 2000, Text: "We went to the park.", FirstWord: 0, WordCount: 5}
+
+	tests := []struct {
+		name string
+		prev *models.Subtitle // Block before the batch, if not prev
+		next []models.Subtitle
+		want []models.Subtitle
+	}{
+		{
+			name: "exact repeat is dropped",
+			next: []models.Subtitle{
+				{StartMs: 1000, EndMs: 2500, Text: "we went to the park"},
+				{StartMs: 2600, EndMs: 4000, Text: "It was sunny."},
+			},
+			want: []models.Subtitle{
+				{StartMs: 2600, EndMs: 4000, Text: "It was sunny."},
+			},
+		},
+		{
+			name: "repeated leading words are removed",
+			next: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "the park. It was sunny."},
+			},
+			want: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "It was sunny."},
+			},
+		},
+		{
+			// A single word said again is kept
+			name: "one repeated word",
+			next: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "park, the big one."},
+			},
+			want: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "park, the big one."},
+			},
+		},
+		{
+			name: "no overlap in text",
+			next: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "It was sunny."},
+			},
+			want: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "It was sunny."},
+			},
+		},
+		{
+			name: "no overlap in time",
+			next: []models.Subtitle{
+				{StartMs: 2000, EndMs: 3000, Text: "We went to the park."},
+			},
+			want: []models.Subtitle{
+				{StartMs: 2000, EndMs: 3000, Text: "We went to the park."},
+			},
+		},
+		{
+			name: "repeat starting after prev's word range",
+			prev: &ranged,
+			next: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "the park. It was sunny.", FirstWord: 5, WordCount: 5},
+			},
+			want: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "It was sunny.", FirstWord: 5, WordCount: 5},
+			},
+		},
+		{
+			// Words were skipped between the blocks, so the text can't be a repeat
+			name: "gap in the word ranges",
+			prev: &ranged,
+			next: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "the park. It was sunny.", FirstWord: 8, WordCount: 5},
+			},
+			want: []models.Subtitle{
+				{StartMs: 1500, EndMs: 3000, Text: "the park. It was sunny.", FirstWord: 8, WordCount: 5},
+			},
+		},
+		{
+			name: "empty batch",
+			next: nil,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := prev
+			if tt.prev != nil {
+				prev = *tt.prev
+			}
+			got := dedupeSeam(prev, tt.next)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dedupeSeam =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimRepeat(t *testing.T) {
+	tests := []struct {
+		name   string
+		prev   string
+		text   string
+		want   string
+		wantOK bool
+	}{
+		{name: "repeated words", prev: "We went to the park.", text: "the park. It was sunny.", want: "It was sunny.", wantOK: true},
+		{name: "whole block repeated", prev: "We went to the park.", text: "We went to the park. It was sunny.", want: "It was sunny.", wantOK: true},
+		{name: "one repeated word", prev: "I said no", text: "no way", wantOK: false},
+		{name: "repeat ending mid-word", prev: "No", text: "Nobody came", wantOK: false},
+		{name: "repeat without a space", prev: "We went to the park.", text: "We went to the park.It was sunny.", wantOK: false},
+		{name: "script without spaces", prev: "เราไปสวนสาธารณะ", text: "เราไปสวนสาธารณะวันนี้อากาศดี", want: "วันนี้อากาศดี", wantOK: true},
+		{name: "no repeat", prev: "We went to the park.", text: "It was sunny.", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := trimRepeat(tt.prev, tt.text)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("trimRepeat(%q, %q) = %q, %v; want %q, %v", tt.prev, tt.text, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
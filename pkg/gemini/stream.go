@@ -0,0 +1,176 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"yt_enhancer/pkg/llm"
+	"yt_enhancer/pkg/models"
+)
+
+// maxStreamLine is the longest server-sent event line accepted from the API
+const maxStreamLine = 4 << 20
+
+// CreateSubtitlesStream is CreateSubtitles, calling onSubtitle with each block as
+// soon as it is known. With a provider that can stream, such as Gemini, a block is
+// reported once the model has finished it and the start of the next block fixes
+// its end time; other providers report the blocks of each batch when it completes.
+//
+// Streamed blocks are provisional: a batch that is retried may report its blocks
+// again, and the final timeline fixups are not applied. The returned subtitles are
+// the authoritative result. Calls to onSubtitle never overlap.
+func (c *Client) CreateSubtitlesStream(ctx context.Context, wordTimings []models.WordTiming,
+	onSubtitle func(models.Subtitle)) ([]models.Subtitle, error) {
+	return c.createSubtitles(ctx, wordTimings, RunOptions{OnSubtitle: onSubtitle})
+}
+
+// StreamSubtitles sends a prompt to the Gemini streamGenerateContent method and
+// calls onText with each piece of the reply as it arrives. It returns the full
+// reply and implements llm.StreamProvider.
+func (c *Client) StreamSubtitles(ctx context.Context, prompt string, onText func(string)) (string, error) {
+	resp, err := c.sendRequest(ctx, "streamGenerateContent", prompt)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var usage UsageMetadata
+	var finishReason string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "data:")
+		if !ok {
+			continue
+		}
+
+		var chunk Response
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("error parsing API stream: %w", err)
+		}
+
+		// Each chunk reports the usage so far, so only the last one counts
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			usage = chunk.UsageMetadata
+		}
+		if err := blockedError(chunk.PromptFeedback); err != nil {
+			return "", err
+		}
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+		if reason := chunk.Candidates[0].FinishReason; reason != "" {
+			finishReason = reason
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			content.WriteString(part.Text)
+			if onText != nil && part.Text != "" {
+				onText(part.Text)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading API stream: %w", err)
+	}
+
+	c.recordUsage(usage)
+	if content.Len() == 0 {
+		return "", fmt.Errorf("no content in the API response: %w", ErrEmptyResponse)
+	}
+	if err := c.finishError(finishReason); err != nil {
+		return "", err
+	}
+	return content.String(), nil
+}
+
+// streamBatch asks provider for the blocks of a batch, passing each block that
+// starts at or after newFrom to progress as soon as the next block arrives, and
+// the last one when the reply is complete. It returns the full reply.
+func (c *Client) streamBatch(ctx context.Context, provider llm.StreamProvider, prompt string,
+	batch []models.WordTiming, newFrom int, progress *runProgress) (string, error) {
+
+	opts := c.parseOptions()
+	emit := func(inputs ...models.SubtitleInput) {
+		if !opts.modelTimings {
+			snapTimings(inputs, batch)
+		}
+		progress.emit(processSubtitles(inputs, batch, opts)[0])
+	}
+
+	var decoder arrayDecoder
+	var pending *models.SubtitleInput
+	content, err := provider.StreamSubtitles(ctx, prompt, func(text string) {
+		for _, raw := range decoder.write(text) {
+			var input models.SubtitleInput
+			if err := json.Unmarshal([]byte(raw), &input); err != nil || input.StartWordIndex < newFrom {
+				continue
+			}
+			if pending != nil {
+				emit(*pending, input)
+			}
+			pending = &input
+		}
+	})
+	if err == nil && pending != nil {
+		emit(*pending)
+	}
+	return content, err
+}
+
+// arrayDecoder picks the objects of a JSON array out of text that arrives in
+// pieces. Anything before the array, such as a markdown code fence, is skipped.
+type arrayDecoder struct {
+	started bool
+	depth   int
+	inStr   bool
+	escaped bool
+	object  strings.Builder
+}
+
+// write adds a piece of text and returns the raw JSON of each top-level array
+// element object completed by it
+func (d *arrayDecoder) write(text string) []string {
+	var objects []string
+	for _, r := range text {
+		if !d.started {
+			if r == '[' {
+				d.started = true
+				d.depth = 1
+			}
+			continue
+		}
+		if d.depth >= 2 {
+			d.object.WriteRune(r)
+		}
+
+		switch {
+		case d.inStr:
+			if d.escaped {
+				d.escaped = false
+			} else if r == '\\' {
+				d.escaped = true
+			} else if r == '"' {
+				d.inStr = false
+			}
+		case r == '"':
+			d.inStr = true
+		case r == '{' || r == '[':
+			d.depth++
+			if d.depth == 2 {
+				d.object.Reset()
+				d.object.WriteRune(r)
+			}
+		case r == '}' || r == ']':
+			d.depth--
+			if d.depth == 1 && r == '}' {
+				objects = append(objects, d.object.String())
+				d.object.Reset()
+			}
+		}
+	}
+	return objects
+}
@@ -0,0 +1,61 @@
+package gemini
+
+import (
+	"log/slog"
+
+	"yt_enhancer/pkg/models"
+)
+
+// snapTimings replaces the st_ms and lw_ms the model copied into each block with
+// the source timings, which it occasionally gets wrong. st_ms becomes the start of
+// the st_id word, and lw_ms the start of the word closest to it from st_id up to
+// the next block's st_id. Blocks whose st_id isn't in wordTimings are left as is.
+func snapTimings(inputs []models.SubtitleInput, wordTimings []models.WordTiming) {
+	if len(wordTimings) == 0 {
+		return
+	}
+	firstID := wordTimings[0].ID
+	position := func(id int) (int, bool) {
+		i := id - firstID
+		return i, i >= 0 && i < len(wordTimings) && wordTimings[i].ID == id
+	}
+
+	for k := range inputs {
+		sub := &inputs[k]
+		start, ok := position(sub.StartWordIndex)
+		if !ok {
+			continue
+		}
+		end := len(wordTimings)
+		if k+1 < len(inputs) {
+			if next, ok := position(inputs[k+1].StartWordIndex); ok && next > start {
+				end = next
+			}
+		}
+
+		startMs := wordTimings[start].StartTime
+		lastMs := sub.LastWordStartMs
+		if lastMs > 0 {
+			lastMs = wordTimings[start].StartTime
+			for _, word := range wordTimings[start:end] {
+				if abs(word.StartTime-sub.LastWordStartMs) <= abs(lastMs-sub.LastWordStartMs) {
+					lastMs = word.StartTime
+				}
+			}
+		}
+
+		if startMs != sub.StartMs || lastMs != sub.LastWordStartMs {
+			slog.Debug("corrected block timing from source words", "st_id", sub.StartWordIndex,
+				"st_ms", sub.StartMs, "source_st_ms", startMs, "lw_ms", sub.LastWordStartMs, "source_lw_ms", lastMs)
+		}
+		sub.StartMs, sub.LastWordStartMs = startMs, lastMs
+	}
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
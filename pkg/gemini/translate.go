@@ -0,0 +1,156 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"yt_enhancer/pkg/models"
+	"yt_enhancer/pkg/redact"
+)
+
+// translateBatchSize is the number of subtitle blocks translated per request
+const translateBatchSize = 100
+
+// translationItem is a subtitle block as sent to and returned by the model
+type translationItem struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+// TranslateSubtitles translates the text of subtitles into targetLang (a language
+// code such as "en"). The result has one block per input block with its timing and
+// position copied unchanged, so the two tracks stay in sync.
+func (c *Client) TranslateSubtitles(ctx context.Context, subtitles []models.Subtitle, targetLang string) ([]models.Subtitle, error) {
+	result := make([]models.Subtitle, len(subtitles))
+	copy(result, subtitles)
+
+	// Redact sensitive text before it leaves the machine
+	var mapping redact.Mapping
+	if c.redactor != nil {
+		words := make([]models.WordTiming, len(result))
+		for i, sub := range result {
+			words[i] = models.WordTiming{ID: i, Word: sub.Text}
+		}
+		words, mapping = c.redactor.Redact(words)
+		for i := range result {
+			result[i].Text = words[i].Word
+		}
+	}
+
+	// Name this run's debug files so they don't collide with other runs'
+	ctx, err := c.startDebugRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batchNum := 0
+	for start := 0; start < len(result); start += translateBatchSize {
+		end := start + translateBatchSize
+		if end > len(result) {
+			end = len(result)
+		}
+		batchNum++
+
+		// Blocks without text, such as silence placeholders, are kept as is
+		var items []translationItem
+		for i := start; i < end; i++ {
+			if result[i].Text != "" {
+				items = append(items, translationItem{ID: i, Text: result[i].Text})
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		slog.Info("translating batch", "batch", batchNum, "first_block", start, "last_block", end-1,
+			"language", targetLang)
+
+		translated, err := c.translateBatch(ctx, items, targetLang, batchNum)
+		if err != nil {
+			return nil, fmt.Errorf("error translating batch %d: %w", batchNum, err)
+		}
+		for _, item := range translated {
+			result[item.ID].Text = mapping.Restore(item.Text)
+		}
+	}
+
+	return result, nil
+}
+
+// translateBatch sends one batch of blocks to the provider and checks that every
+// block came back translated exactly once
+func (c *Client) translateBatch(ctx context.Context, items []translationItem, targetLang string, batchNum int) ([]translationItem, error) {
+	prompt := buildTranslatePrompt(items, targetLang)
+	c.saveDebugFile(ctx, fmt.Sprintf("translate_%d_prompt.txt", batchNum), "translation prompt", batchNum, []byte(prompt))
+
+	// Reuse the reply to an identical earlier request, if cached
+	content, cached := c.cachedResponse(prompt)
+	if !cached {
+		// Respect the shared request rate limit
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		reqCtx, cancel := c.requestContext(ctx, len(items))
+		started := time.Now()
+		var err error
+		content, err = c.provider.GenerateSubtitles(reqCtx, prompt)
+		cancel()
+		c.observeRequest(ctx, started, err)
+		if err != nil {
+			return nil, c.requestError(ctx, err)
+		}
+	}
+	c.saveDebugFile(ctx, fmt.Sprintf("translate_%d_response.json", batchNum), "translation response", batchNum, []byte(content))
+
+	var translated []translationItem
+	jsonContent := cleanJsonContent(content)
+	if err := json.Unmarshal([]byte(jsonContent), &translated); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response: %w\nResponse was: %s", err, jsonContent)
+	}
+
+	// Every block must be translated, and nothing else
+	want := make(map[int]bool, len(items))
+	for _, item := range items {
+		want[item.ID] = true
+	}
+	for _, item := range translated {
+		if !want[item.ID] {
+			return nil, fmt.Errorf("translation has unexpected or repeated block id %d", item.ID)
+		}
+		delete(want, item.ID)
+	}
+	if len(want) > 0 {
+		return nil, fmt.Errorf("translation is missing %d of %d blocks", len(want), len(items))
+	}
+
+	if !cached {
+		c.storeResponse(prompt, content)
+	}
+
+	return translated, nil
+}
+
+// buildTranslatePrompt builds the prompt for translating a batch of blocks
+func buildTranslatePrompt(items []translationItem, targetLang string) string {
+	prompt := `Translate the text of these subtitle blocks into ` + languageName(targetLang) + `.
+
+REQUIREMENTS:
+- Translate each block on its own, keeping its meaning within the block
+- Keep the same "id" for each block; DO NOT merge, split, add or drop blocks
+- Keep placeholders such as [PII1] unchanged
+- Use natural, concise subtitle language
+
+RETURN FORMAT:
+Return ONLY a clean JSON array with exactly this format:
+[{"id": 0,"text": "Translated text here"},...]
+
+SUBTITLE BLOCKS:
+`
+
+	itemsJSON, _ := json.MarshalIndent(items, "", "  ")
+	return prompt + string(itemsJSON)
+}
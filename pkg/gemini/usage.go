@@ -0,0 +1,67 @@
+package gemini
+
+import "log/slog"
+
+// UsageMetadata holds the token counts reported by the Gemini API for a request
+type UsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// Usage accumulates API usage across all requests made by a client
+type Usage struct {
+	APICalls     int
+	Batches      int // Transcript batches sent, not counting retries
+	PromptTokens int
+	OutputTokens int
+	Retries      int // Batches that had to be requested again
+}
+
+// EstimatedCost returns the cost of the accumulated usage given per-1K-token prices
+func (u Usage) EstimatedCost(promptPricePer1K, outputPricePer1K float64) float64 {
+	return float64(u.PromptTokens)/1000*promptPricePer1K +
+		float64(u.OutputTokens)/1000*outputPricePer1K
+}
+
+// recordUsage adds the usage of a single API call to the client's totals
+func (c *Client) recordUsage(meta UsageMetadata) {
+	c.usageMu.Lock()
+	c.usage.APICalls++
+	c.usage.PromptTokens += meta.PromptTokenCount
+	c.usage.OutputTokens += meta.CandidatesTokenCount
+	c.usageMu.Unlock()
+
+	slog.Debug("request token usage", "prompt_tokens", meta.PromptTokenCount,
+		"output_tokens", meta.CandidatesTokenCount)
+	if c.Metrics != nil {
+		c.Metrics.ObserveTokens(meta.PromptTokenCount, meta.CandidatesTokenCount)
+	}
+}
+
+// recordBatch counts a transcript batch sent for the first time
+func (c *Client) recordBatch() {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+
+	c.usage.Batches++
+}
+
+// recordRetry counts a batch that had to be requested again for reason
+func (c *Client) recordRetry(reason string) {
+	c.usageMu.Lock()
+	c.usage.Retries++
+	c.usageMu.Unlock()
+
+	if c.Metrics != nil {
+		c.Metrics.ObserveRetry(reason)
+	}
+}
+
+// Usage returns the API usage accumulated by the client so far
+func (c *Client) Usage() Usage {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+
+	return c.usage
+}
@@ -0,0 +1,42 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is returned by providers when the model stopped its reply at the
+// output token limit, leaving the JSON unfinished
+var ErrTruncated = errors.New("response was cut off at the output token limit")
+
+// Provider is a language model backend that turns a subtitle prompt into the
+// model's raw text reply. Prompt building and response parsing are shared by all
+// providers, so implementations only handle the API round-trip.
+type Provider interface {
+	GenerateSubtitles(ctx context.Context, prompt string) (string, error)
+}
+
+// HealthChecker is implemented by providers that can verify their backend is
+// reachable before any batches are sent
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// StreamProvider is implemented by providers that can stream the model's reply.
+// StreamSubtitles calls onText with each piece of text as it arrives and returns
+// the full reply, as GenerateSubtitles would.
+type StreamProvider interface {
+	StreamSubtitles(ctx context.Context, prompt string, onText func(string)) (string, error)
+}
+
+// StatusError is returned by providers when the API answers with an HTTP error
+// status, so callers can tell rate limiting and server errors apart
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// New creates a logger writing to w. level is one of "debug", "info", "warn" or
+// "error" (default "info") and format is "text" or "json" (default "text").
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "", "info":
+		lvl = slog.LevelInfo
+	case "warn", "warning":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		return nil, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (expected text or json)", format)
+	}
+}
+
+// Setup creates a logger with New and installs it as the slog default
+func Setup(w io.Writer, level, format string) error {
+	logger, err := New(w, level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
@@ -5,9 +5,32 @@ import "encoding/xml"
 // XML Structure definitions to parse the timedtext format
 type TimedText struct {
 	XMLName xml.Name `xml:"timedtext"`
+	Head    Head     `xml:"head"`
 	Body    Body     `xml:"body"`
 }
 
+type Head struct {
+	Pens            []Pen            `xml:"pen"`
+	WindowPositions []WindowPosition `xml:"wp"`
+}
+
+// Pen is an srv3 text style; "1" turns bold, italic or underline on
+type Pen struct {
+	ID        string `xml:"id,attr"`
+	Bold      string `xml:"b,attr"`
+	Italic    string `xml:"i,attr"`
+	Underline string `xml:"u,attr"`
+}
+
+// WindowPosition is an srv3 window position: an anchor point (0-8, row-major from
+// top-left) placed at a horizontal/vertical percentage of the video frame
+type WindowPosition struct {
+	ID          string `xml:"id,attr"`
+	AnchorPoint string `xml:"ap,attr"`
+	Horizontal  string `xml:"ah,attr"`
+	Vertical    string `xml:"av,attr"`
+}
+
 type Body struct {
 	Paragraphs []Paragraph `xml:"p"`
 }
@@ -17,6 +40,9 @@ type Paragraph struct {
 	Duration  string     `xml:"d,attr"`
 	A         string     `xml:"a,attr"`
 	W         string     `xml:"w,attr"`
+	WP        string     `xml:"wp,attr"`
+	P         string     `xml:"p,attr"`
+	Ac        string     `xml:"ac,attr"`
 	Content   string     `xml:",chardata"`
 	Sentences []Sentence `xml:"s"`
 }
@@ -24,21 +50,51 @@ type Paragraph struct {
 type Sentence struct {
 	Time string `xml:"t,attr"`
 	Ac   string `xml:"ac,attr"`
+	P    string `xml:"p,attr"`
 	Text string `xml:",chardata"`
 }
 
+// Position is an on-screen caption placement
+type Position struct {
+	AnchorPoint int `json:"anchor_point"` // 0-8, row-major from top-left (srv3 "ap")
+	X           int `json:"x"`            // Horizontal position in percent of the frame width
+	Y           int `json:"y"`            // Vertical position in percent of the frame height
+}
+
+// TextStyle is the emphasis of a caption word
+type TextStyle struct {
+	Bold      bool
+	Italic    bool
+	Underline bool
+}
+
 // WordTiming represents a single word with its timing information
 type WordTiming struct {
-	ID        int    `json:"id"`       // Global index of the word in the transcript
-	Word      string `json:"word"`     // The word text
-	StartTime int    `json:"start_ms"` // Start time in milliseconds
+	ID         int       `json:"id"`                  // Global index of the word in the transcript
+	Word       string    `json:"word"`                // The word text
+	StartTime  int       `json:"start_ms"`            // Start time in milliseconds
+	DurationMs int       `json:"-"`                   // How long the word is spoken, 0 if unknown
+	Position   *Position `json:"-"`                   // Caption placement from the source, if any
+	Style      TextStyle `json:"-"`                   // Emphasis from the source's pen, if any
+	Confidence *float64  `json:"-"`                   // Recognition confidence from 0 to 1 (srv3 "ac"), if known
+	Uncertain  bool      `json:"uncertain,omitempty"` // Marked in the prompt as poorly recognized
 }
 
 // Subtitle represents a subtitle block with start time, end time, and text
 type Subtitle struct {
+	StartMs   int       `json:"start_ms"`
+	EndMs     int       `json:"end_ms"`
+	Text      string    `json:"text"`
+	Position  *Position `json:"position,omitempty"`
+	FirstWord int       `json:"-"` // ID of the block's first source word
+	WordCount int       `json:"-"` // Number of source words in the block, 0 if unknown
+}
+
+// Chapter represents a video chapter as reported by yt-dlp
+type Chapter struct {
 	StartMs int    `json:"start_ms"`
 	EndMs   int    `json:"end_ms"`
-	Text    string `json:"text"`
+	Title   string `json:"title"`
 }
 
 // SubtitleInput is used to parse the API response
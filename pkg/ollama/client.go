@@ -0,0 +1,135 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"yt_enhancer/pkg/config"
+	"yt_enhancer/pkg/llm"
+)
+
+// Client is a client for a local Ollama server
+type Client struct {
+	config     *config.Config
+	httpClient *http.Client
+
+	// OnUsage, if set, is called with the token counts reported for each request
+	OnUsage func(promptTokens, outputTokens int)
+}
+
+type generateRequest struct {
+	Model   string                 `json:"model"`
+	Prompt  string                 `json:"prompt"`
+	Stream  bool                   `json:"stream"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// Response structure for the generate API
+type generateResponse struct {
+	Response        string `json:"response"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+// NewClient creates a new Ollama client
+func NewClient(cfg *config.Config) *Client {
+	return &Client{
+		config: cfg,
+		httpClient: &http.Client{
+			Timeout: 300 * time.Second, // Local models are much slower than hosted APIs
+		},
+	}
+}
+
+// HealthCheck verifies that the Ollama server is reachable. It implements
+// llm.HealthChecker.
+func (c *Client) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url("/api/tags"), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ollama server is not reachable at %s (is `ollama serve` running?): %w",
+			c.config.OllamaBaseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama server at %s returned status %d", c.config.OllamaBaseURL, resp.StatusCode)
+	}
+	return nil
+}
+
+// options returns the model options of a request, pinning sampling down in
+// deterministic mode
+func (c *Client) options() map[string]interface{} {
+	options := map[string]interface{}{
+		"temperature": c.config.Temperature(),
+		"num_predict": c.config.GeminiMaxTokens,
+	}
+	if c.config.Deterministic {
+		options["seed"] = config.DeterministicSeed
+		options["top_k"] = 1
+	}
+	return options
+}
+
+// GenerateSubtitles sends the prompt to the generate endpoint without streaming
+// and returns the model's reply. It implements llm.Provider.
+func (c *Client) GenerateSubtitles(ctx context.Context, prompt string) (string, error) {
+	reqBody, err := json.Marshal(generateRequest{
+		Model:   c.config.OllamaModel,
+		Prompt:  prompt,
+		Stream:  false,
+		Options: c.options(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url("/api/generate"), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making API request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &llm.StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var genResp generateResponse
+	if err := json.Unmarshal(respBody, &genResp); err != nil {
+		return "", fmt.Errorf("error parsing API response: %w", err)
+	}
+
+	if c.OnUsage != nil {
+		c.OnUsage(genResp.PromptEvalCount, genResp.EvalCount)
+	}
+
+	return genResp.Response, nil
+}
+
+// url joins a path onto the configured server address
+func (c *Client) url(path string) string {
+	return strings.TrimSuffix(c.config.OllamaBaseURL, "/") + path
+}
@@ -0,0 +1,133 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"yt_enhancer/pkg/config"
+	"yt_enhancer/pkg/llm"
+)
+
+// systemPrompt instructs the model to reply with the bare JSON array
+const systemPrompt = "You convert transcripts into subtitle blocks. Reply with JSON only, " +
+	"exactly in the requested format, without markdown fences or commentary."
+
+// Client is a client for OpenAI-compatible chat completion APIs
+type Client struct {
+	config     *config.Config
+	httpClient *http.Client
+
+	// OnUsage, if set, is called with the token counts reported for each request
+	OnUsage func(promptTokens, outputTokens int)
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Seed        *int          `json:"seed,omitempty"`
+}
+
+// Response structures for the chat completions API
+type chatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// NewClient creates a new OpenAI-compatible API client
+func NewClient(cfg *config.Config) *Client {
+	return &Client{
+		config: cfg,
+		httpClient: &http.Client{
+			Timeout: 120 * time.Second,
+		},
+	}
+}
+
+// seed returns the sampling seed to send, which is only set in deterministic mode
+func (c *Client) seed() *int {
+	if !c.config.Deterministic {
+		return nil
+	}
+	seed := config.DeterministicSeed
+	return &seed
+}
+
+// GenerateSubtitles sends the prompt as a user message to the chat completions
+// endpoint and returns the reply. It implements llm.Provider.
+func (c *Client) GenerateSubtitles(ctx context.Context, prompt string) (string, error) {
+	reqBody, err := json.Marshal(chatRequest{
+		Model: c.config.OpenAIModel,
+		Messages: []chatMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		Temperature: c.config.Temperature(),
+		MaxTokens:   c.config.GeminiMaxTokens,
+		Seed:        c.seed(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	url := strings.TrimSuffix(c.config.OpenAIBaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.config.OpenAIAPIKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making API request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &llm.StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var chatResp chatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return "", fmt.Errorf("error parsing API response: %w", err)
+	}
+
+	if c.OnUsage != nil {
+		c.OnUsage(chatResp.Usage.PromptTokens, chatResp.Usage.CompletionTokens)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("no content in the API response")
+	}
+	if chatResp.Choices[0].FinishReason == "length" {
+		return "", fmt.Errorf("%w (GEMINI_MAX_TOKENS is %d); raise it or lower GEMINI_BATCH_SIZE",
+			llm.ErrTruncated, c.config.GeminiMaxTokens)
+	}
+
+	return chatResp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// utf8BOM is the byte order mark some editors, notably on Windows, put at the
+// start of UTF-8 files
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// trimBOM removes a leading UTF-8 byte order mark from data
+func trimBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, utf8BOM)
+}
+
+// decodeUTF16 converts data to UTF-8 if it starts with a UTF-16 byte order mark,
+// and returns it unchanged otherwise. The XML decoder can't read a UTF-16
+// encoding declaration until the data is converted.
+func decodeUTF16(data []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		order = binary.BigEndian
+	default:
+		return data
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// windows1252 maps the bytes 0x80-0x9f of Windows-1252 to runes; the rest of the
+// encoding matches ISO-8859-1. Unassigned bytes map to U+FFFD.
+var windows1252 = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// charsetReader returns a reader converting input in the encoding named by an XML
+// declaration to UTF-8. It supports ASCII, ISO-8859-1, Windows-1252 and UTF-16,
+// which decodeUTF16 has already converted by the time the declaration is read.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(label) {
+	case "us-ascii", "ascii", "utf-16", "utf-16le", "utf-16be":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		return singleByteReader(input, nil)
+	case "windows-1252", "cp1252":
+		return singleByteReader(input, &windows1252)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q (supported: utf-8, utf-16, iso-8859-1, windows-1252)", label)
+	}
+}
+
+// singleByteReader converts input in ISO-8859-1, or Windows-1252 if high maps its
+// bytes 0x80-0x9f, to UTF-8
+func singleByteReader(input io.Reader, high *[32]rune) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		r := rune(b)
+		if high != nil && b >= 0x80 && b <= 0x9f {
+			r = high[b-0x80]
+		}
+		out = utf8.AppendRune(out, r)
+	}
+	return bytes.NewReader(out), nil
+}
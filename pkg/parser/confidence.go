@@ -0,0 +1,15 @@
+package parser
+
+import "yt_enhancer/pkg/models"
+
+// MarkUncertain flags the words recognized with a confidence below threshold, so
+// the prompt tells the model to treat them with care. Words without a confidence
+// are never flagged.
+func MarkUncertain(wordTimings []models.WordTiming, threshold float64) []models.WordTiming {
+	marked := make([]models.WordTiming, len(wordTimings))
+	for i, word := range wordTimings {
+		word.Uncertain = word.Confidence != nil && *word.Confidence < threshold
+		marked[i] = word
+	}
+	return marked
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"yt_enhancer/pkg/models"
+)
+
+// Supported input caption formats
+const (
+	FormatSRV3  = "srv3"
+	FormatJSON3 = "json3"
+	FormatVTT   = "vtt"
+)
+
+// InputFormats lists the caption formats DetectFormat recognizes
+var InputFormats = []string{FormatSRV3, FormatJSON3, FormatVTT}
+
+// DetectFormat identifies the caption format of a file, first by extension and then
+// by sniffing its content for an XML <timedtext> root, a WEBVTT header or a JSON object
+func DetectFormat(filePath string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".srv3":
+		return FormatSRV3, nil
+	case ".json3":
+		return FormatJSON3, nil
+	case ".vtt":
+		return FormatVTT, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	format, ok := sniffFormat(data)
+	if !ok {
+		return "", fmt.Errorf("unknown caption format in %s (supported: %s)", filePath, strings.Join(InputFormats, ", "))
+	}
+	return format, nil
+}
+
+// sniffFormat identifies the caption format of data from its content
+func sniffFormat(data []byte) (string, bool) {
+	content := bytes.TrimSpace(trimBOM(decodeUTF16(data)))
+
+	switch {
+	case bytes.HasPrefix(content, []byte("WEBVTT")):
+		return FormatVTT, true
+	case bytes.HasPrefix(content, []byte("{")):
+		return FormatJSON3, true
+	case bytes.HasPrefix(content, []byte("<")) && bytes.Contains(content, []byte("<timedtext")):
+		return FormatSRV3, true
+	}
+	return "", false
+}
+
+// ParseFile parses an srv3 or json3 caption file into a TimedText structure
+func ParseFile(filePath string) (models.TimedText, error) {
+	format, err := DetectFormat(filePath)
+	if err != nil {
+		return models.TimedText{}, err
+	}
+
+	switch format {
+	case FormatJSON3:
+		return ParseJSON3File(filePath)
+	case FormatSRV3:
+		return ParseXMLFile(filePath)
+	default:
+		return models.TimedText{}, fmt.Errorf("%s captions have no timed text structure", format)
+	}
+}
+
+// ParseWordTimings detects the format of a caption file and returns its word timings
+func ParseWordTimings(filePath string) ([]models.WordTiming, error) {
+	format, err := DetectFormat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatVTT:
+		subs, err := ParseVTTFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return SubtitlesToWordTimings(subs, ""), nil
+	default:
+		timedText, err := ParseFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return ExtractWordTimings(timedText), nil
+	}
+}
+
+// ParseWordTimingsReader reads captions from r, such as stdin or an HTTP response
+// body, detects their format from the content and returns their word timings
+func ParseWordTimingsReader(r io.Reader) ([]models.WordTiming, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading captions: %w", err)
+	}
+
+	format, ok := sniffFormat(data)
+	if !ok {
+		return nil, fmt.Errorf("unknown caption format (supported: %s)", strings.Join(InputFormats, ", "))
+	}
+
+	switch format {
+	case FormatVTT:
+		subs, err := parseVTT(data)
+		if err != nil {
+			return nil, err
+		}
+		return SubtitlesToWordTimings(subs, ""), nil
+	case FormatJSON3:
+		timedText, err := parseJSON3(data)
+		if err != nil {
+			return nil, err
+		}
+		return ExtractWordTimings(timedText), nil
+	default:
+		timedText, err := parseXML(data)
+		if err != nil {
+			return nil, err
+		}
+		return ExtractWordTimings(timedText), nil
+	}
+}
@@ -0,0 +1,32 @@
+package parser
+
+import "yt_enhancer/pkg/models"
+
+// FormatWords wraps the text of styled words in the inline tags SRT and WebVTT
+// understand, e.g. "<i>word</i>" for an italic pen, so the emphasis carries into
+// the subtitle text. subtitle.CleanTags later joins the spans of adjacent words.
+func FormatWords(wordTimings []models.WordTiming) []models.WordTiming {
+	formatted := make([]models.WordTiming, len(wordTimings))
+	for i, word := range wordTimings {
+		for _, tag := range styleTags(word.Style) {
+			word.Word = "<" + tag + ">" + word.Word + "</" + tag + ">"
+		}
+		formatted[i] = word
+	}
+	return formatted
+}
+
+// styleTags returns the tags of a style, innermost first
+func styleTags(style models.TextStyle) []string {
+	var tags []string
+	if style.Underline {
+		tags = append(tags, "u")
+	}
+	if style.Italic {
+		tags = append(tags, "i")
+	}
+	if style.Bold {
+		tags = append(tags, "b")
+	}
+	return tags
+}
@@ -0,0 +1,42 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"yt_enhancer/pkg/models"
+)
+
+// infoJSON is the subset of yt-dlp's .info.json used by the parser
+type infoJSON struct {
+	Chapters []struct {
+		StartTime float64 `json:"start_time"`
+		EndTime   float64 `json:"end_time"`
+		Title     string  `json:"title"`
+	} `json:"chapters"`
+}
+
+// ParseChapters reads the chapter markers from a yt-dlp .info.json file
+func ParseChapters(filePath string) ([]models.Chapter, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	var info infoJSON
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("error parsing info JSON: %w", err)
+	}
+
+	chapters := make([]models.Chapter, 0, len(info.Chapters))
+	for _, ch := range info.Chapters {
+		chapters = append(chapters, models.Chapter{
+			StartMs: int(ch.StartTime * 1000),
+			EndMs:   int(ch.EndTime * 1000),
+			Title:   ch.Title,
+		})
+	}
+
+	return chapters, nil
+}
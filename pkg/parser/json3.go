@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"yt_enhancer/pkg/models"
+)
+
+// JSON structure definitions for YouTube's json3 caption format
+type json3File struct {
+	Events []json3Event `json:"events"`
+}
+
+type json3Event struct {
+	TStartMs    int        `json:"tStartMs"`
+	DDurationMs int        `json:"dDurationMs"`
+	Segs        []json3Seg `json:"segs"`
+}
+
+type json3Seg struct {
+	UTF8      string `json:"utf8"`
+	TOffsetMs int    `json:"tOffsetMs"`
+}
+
+// ParseJSON3File reads a json3 caption file and maps its events onto the same
+// TimedText structure the srv3 parser produces, so ExtractWordTimings works unchanged
+func ParseJSON3File(filePath string) (models.TimedText, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return models.TimedText{}, fmt.Errorf("error reading file: %w", err)
+	}
+	return parseJSON3(data)
+}
+
+// parseJSON3 parses json3 caption data
+func parseJSON3(data []byte) (models.TimedText, error) {
+	var timedText models.TimedText
+
+	var file json3File
+	if err := json.Unmarshal(trimBOM(data), &file); err != nil {
+		return timedText, fmt.Errorf("error parsing json3: %w", err)
+	}
+
+	for _, event := range file.Events {
+		paragraph := models.Paragraph{
+			Time:     strconv.Itoa(event.TStartMs),
+			Duration: strconv.Itoa(event.DDurationMs),
+		}
+		for _, seg := range event.Segs {
+			paragraph.Sentences = append(paragraph.Sentences, models.Sentence{
+				Time: strconv.Itoa(seg.TOffsetMs),
+				Text: seg.UTF8,
+			})
+		}
+		timedText.Body.Paragraphs = append(timedText.Body.Paragraphs, paragraph)
+	}
+
+	return timedText, nil
+}
@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -12,37 +15,101 @@ import (
 
 // ParseXMLFile reads and parses an XML file containing timed text
 func ParseXMLFile(filePath string) (models.TimedText, error) {
-	var timedText models.TimedText
-
 	// Read the XML file
 	xmlData, err := os.ReadFile(filePath)
 	if err != nil {
-		return timedText, fmt.Errorf("error reading file: %w", err)
+		return models.TimedText{}, fmt.Errorf("error reading file: %w", err)
 	}
+	return parseXML(xmlData)
+}
 
-	// Remove the filepath comment line if present
-	xmlContent := string(xmlData)
-	lines := strings.Split(xmlContent, "\n")
-	for i, line := range lines {
-		if strings.Contains(line, "// filepath:") {
-			xmlContent = strings.Join(lines[i+1:], "\n")
-			break
-		}
+// ParseReader reads and parses timed text XML from r, such as captions piped to
+// stdin or fetched over HTTP
+func ParseReader(r io.Reader) (models.TimedText, error) {
+	xmlData, err := io.ReadAll(r)
+	if err != nil {
+		return models.TimedText{}, fmt.Errorf("error reading captions: %w", err)
 	}
+	return parseXML(xmlData)
+}
 
-	// Parse the XML
-	err = xml.Unmarshal([]byte(xmlContent), &timedText)
-	if err != nil {
-		return timedText, fmt.Errorf("error parsing XML: %w", err)
+// XMLError is a timed text parse error with the position it happened at
+type XMLError struct {
+	Offset int64 // Byte offset into the XML
+	Line   int   // Line number, starting at 1
+	Err    error
+}
+
+func (e *XMLError) Error() string {
+	// Syntax errors already name their line
+	msg := e.Err.Error()
+	var syntaxErr *xml.SyntaxError
+	if errors.As(e.Err, &syntaxErr) {
+		msg = syntaxErr.Msg
 	}
+	return fmt.Sprintf("%s at line %d (byte %d)", msg, e.Line, e.Offset)
+}
 
-	return timedText, nil
+func (e *XMLError) Unwrap() error {
+	return e.Err
 }
 
-// ExtractWordTimings extracts word timings from a TimedText structure
+// parseXML parses timed text XML
+func parseXML(xmlData []byte) (models.TimedText, error) {
+	var timedText models.TimedText
+
+	// Convert UTF-16 to UTF-8 and drop a byte order mark, which would otherwise
+	// end up in front of the first word
+	xmlData = trimBOM(decodeUTF16(xmlData))
+
+	// Find the root element, which must be <timedtext>. Anything before it that
+	// isn't an element, such as whitespace or stray text, is skipped. Encodings
+	// other than UTF-8 named by the XML declaration are converted.
+	decoder := xml.NewDecoder(bytes.NewReader(xmlData))
+	decoder.CharsetReader = charsetReader
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return timedText, xmlError(xmlData, offset, errors.New("expected <timedtext>, got end of file"))
+		}
+		if err != nil {
+			return timedText, xmlError(xmlData, decoder.InputOffset(), err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "timedtext" {
+			return timedText, xmlError(xmlData, offset, fmt.Errorf("expected <timedtext>, got <%s>", start.Name.Local))
+		}
+
+		// Parse the XML
+		if err := decoder.DecodeElement(&timedText, &start); err != nil {
+			return timedText, xmlError(xmlData, decoder.InputOffset(), err)
+		}
+		return timedText, nil
+	}
+}
+
+// xmlError wraps err from parsing data with the line and byte offset it happened at
+func xmlError(data []byte, offset int64, err error) error {
+	offset = min(offset, int64(len(data)))
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	return fmt.Errorf("error parsing XML: %w", &XMLError{Offset: offset, Line: line, Err: err})
+}
+
+// ExtractWordTimings extracts word timings from a TimedText structure. Segment
+// offsets are relative to their paragraph; a segment without an offset continues
+// the previous one, as in karaoke-style captions that split a timed word across
+// several styled segments. Windowed paragraphs that repeat the words still shown
+// in their window only contribute the new words.
 func ExtractWordTimings(timedText models.TimedText) []models.WordTiming {
 	var wordTimings []models.WordTiming
-	wordID := 0
+	positions := windowPositions(timedText.Head)
+	pens := penStyles(timedText.Head)
+	shown := make(map[string]windowText)
 
 	for _, paragraph := range timedText.Body.Paragraphs {
 		// Skip empty paragraphs or those without sentences
@@ -51,25 +118,156 @@ func ExtractWordTimings(timedText models.TimedText) []models.WordTiming {
 		}
 
 		paragraphTime, _ := strconv.Atoi(paragraph.Time)
+		paragraphDuration, _ := strconv.Atoi(paragraph.Duration)
 
-		for _, sentence := range paragraph.Sentences {
-			sentenceTime, _ := strconv.Atoi(sentence.Time)
-			startTime := paragraphTime + sentenceTime
+		segments := paragraphSegments(paragraph, pens)
+		texts := make([]string, len(segments))
+		for i, seg := range segments {
+			texts[i] = seg.text
+		}
 
-			// Skip empty sentences
-			if strings.TrimSpace(sentence.Text) == "" {
-				continue
+		// Drop the words a windowed paragraph repeats from the one still on screen
+		skip := 0
+		if paragraph.W != "" {
+			if prev, ok := shown[paragraph.W]; ok && paragraphTime < prev.endMs && hasPrefix(texts, prev.texts) {
+				skip = len(prev.texts)
+			}
+			shown[paragraph.W] = windowText{texts: texts, endMs: paragraphTime + paragraphDuration}
+		}
+
+		for i := skip; i < len(segments); i++ {
+			seg := segments[i]
+
+			// A word lasts until the next segment starts, or the paragraph ends
+			duration := 0
+			if i+1 < len(segments) {
+				duration = segments[i+1].offset - seg.offset
+			} else if paragraphDuration > 0 {
+				duration = paragraphDuration - seg.offset
+			}
+			if duration < 0 {
+				duration = 0
 			}
 
 			wordTimings = append(wordTimings, models.WordTiming{
-				ID:        wordID,
-				Word:      strings.TrimSpace(sentence.Text),
-				StartTime: startTime,
+				ID:         len(wordTimings),
+				Word:       seg.text,
+				StartTime:  paragraphTime + seg.offset,
+				DurationMs: duration,
+				Position:   positions[paragraph.WP],
+				Style:      seg.style,
+				Confidence: seg.confidence,
 			})
-
-			wordID++
 		}
 	}
 
 	return wordTimings
 }
+
+// segment is a timed word of an srv3 paragraph, offset from the paragraph start
+type segment struct {
+	offset     int
+	text       string
+	style      models.TextStyle
+	confidence *float64
+}
+
+// windowText is the text of the paragraph last shown in an srv3 window
+type windowText struct {
+	texts []string
+	endMs int
+}
+
+// paragraphSegments returns the non-empty timed words of a paragraph. Segments
+// without an offset are joined onto the previous word, and offsets never go
+// backwards. A word is styled by its own pen, or else its paragraph's, and takes
+// its confidence from its own "ac", or else its paragraph's; a joined word keeps
+// the lowest confidence of its parts.
+func paragraphSegments(paragraph models.Paragraph, pens map[string]models.TextStyle) []segment {
+	var segments []segment
+	for i, sentence := range paragraph.Sentences {
+		confidence := parseConfidence(sentence.Ac)
+		if confidence == nil {
+			confidence = parseConfidence(paragraph.Ac)
+		}
+
+		if i > 0 && sentence.Time == "" && len(segments) > 0 {
+			last := &segments[len(segments)-1]
+			last.text = strings.TrimSpace(last.text + sentence.Text)
+			if confidence != nil && (last.confidence == nil || *confidence < *last.confidence) {
+				last.confidence = confidence
+			}
+			continue
+		}
+
+		text := strings.TrimSpace(sentence.Text)
+		if text == "" {
+			continue
+		}
+
+		offset, _ := strconv.Atoi(sentence.Time)
+		if len(segments) > 0 && offset < segments[len(segments)-1].offset {
+			offset = segments[len(segments)-1].offset
+		}
+
+		pen := sentence.P
+		if pen == "" {
+			pen = paragraph.P
+		}
+		segments = append(segments, segment{offset: offset, text: text, style: pens[pen], confidence: confidence})
+	}
+	return segments
+}
+
+// parseConfidence converts an srv3 "ac" auto-caption confidence, from 0 to 255, to
+// a fraction from 0 to 1. It returns nil if ac is empty or not a number.
+func parseConfidence(ac string) *float64 {
+	n, err := strconv.Atoi(ac)
+	if err != nil {
+		return nil
+	}
+	confidence := float64(min(max(n, 0), 255)) / 255
+	return &confidence
+}
+
+// hasPrefix reports whether texts starts with all of prefix
+func hasPrefix(texts, prefix []string) bool {
+	if len(prefix) == 0 || len(prefix) > len(texts) {
+		return false
+	}
+	for i := range prefix {
+		if texts[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// penStyles maps srv3 pen IDs to the emphasis they turn on
+func penStyles(head models.Head) map[string]models.TextStyle {
+	styles := make(map[string]models.TextStyle)
+	for _, pen := range head.Pens {
+		styles[pen.ID] = models.TextStyle{
+			Bold:      pen.Bold == "1",
+			Italic:    pen.Italic == "1",
+			Underline: pen.Underline == "1",
+		}
+	}
+	return styles
+}
+
+// windowPositions maps srv3 window position IDs to caption positions
+func windowPositions(head models.Head) map[string]*models.Position {
+	positions := make(map[string]*models.Position)
+	for _, wp := range head.WindowPositions {
+		ap, err := strconv.Atoi(wp.AnchorPoint)
+		if err != nil {
+			ap = 7 // bottom-center
+		}
+		x, _ := strconv.Atoi(wp.Horizontal)
+		y, _ := strconv.Atoi(wp.Vertical)
+
+		positions[wp.ID] = &models.Position{AnchorPoint: ap, X: x, Y: y}
+	}
+	return positions
+}
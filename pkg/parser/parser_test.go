@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKaraokeWordTimings(t *testing.T) {
+	words, err := ParseWordTimings("testdata/karaoke.srv3")
+	if err != nil {
+		t.Fatalf("ParseWordTimings: %v", err)
+	}
+
+	// Offsets are relative to the paragraph, an untimed segment joins the word
+	// before it, and the second paragraph of window 1 only adds its new word
+	want := []struct {
+		word       string
+		startMs    int
+		durationMs int
+	}{
+		{"Good", 1000, 400},
+		{"morning", 1400, 800},
+		{"everyone", 2200, 800},
+		{"today", 3800, 200},
+	}
+	if len(words) != len(want) {
+		t.Fatalf("got %d words, want %d: %+v", len(words), len(want), words)
+	}
+	for i, w := range want {
+		got := words[i]
+		if got.ID != i || got.Word != w.word || got.StartTime != w.startMs || got.DurationMs != w.durationMs {
+			t.Errorf("word %d = {ID:%d Word:%q Start:%d Duration:%d}, want {ID:%d Word:%q Start:%d Duration:%d}",
+				i, got.ID, got.Word, got.StartTime, got.DurationMs, i, w.word, w.startMs, w.durationMs)
+		}
+	}
+}
+
+func TestParseReaderKeepsFilepathText(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want []string
+	}{
+		{
+			// Captions reading out code once lost everything up to such a line
+			name: "filepath in a caption",
+			xml: `<timedtext format="3"><body>
+<p t="0" d="1000"><s>open</s><s t="300"> the</s><s t="500"> file</s></p>
+<p t="1000" d="1000"><s>//</s><s t="200"> filepath:</s><s t="500"> src/main.go</s></p>
+<p t="2000" d="1000"><s>and</s><s t="300"> run</s><s t="500"> it</s></p>
+</body></timedtext>`,
+			want: []string{"open", "the", "file", "//", "filepath:", "src/main.go", "and", "run", "it"},
+		},
+		{
+			name: "stray line before the root",
+			xml: "// filepath: captions.srv3\n" + `<timedtext format="3"><body>
+<p t="0" d="1000"><s>hello</s></p>
+</body></timedtext>`,
+			want: []string{"hello"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timedText, err := ParseReader(strings.NewReader(tt.xml))
+			if err != nil {
+				t.Fatalf("ParseReader: %v", err)
+			}
+			var got []string
+			for _, word := range ExtractWordTimings(timedText) {
+				got = append(got, word.Word)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("words = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
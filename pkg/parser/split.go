@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"yt_enhancer/pkg/models"
+)
+
+// unspacedScripts are scripts written without spaces between words, where a space
+// marks a phrase or sentence break rather than a word boundary
+var unspacedScripts = []*unicode.RangeTable{
+	unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar,
+	unicode.Han, unicode.Hiragana, unicode.Katakana,
+}
+
+// SplitWords splits timed segments holding several space-separated words, as in
+// English auto-captions, into one timing per word. A segment's duration is shared
+// among its words in proportion to their length, and each word starts where the
+// previous one's share ends. Segments in Thai, Chinese, Japanese and other scripts
+// without spaces between words are kept whole. IDs are renumbered.
+func SplitWords(wordTimings []models.WordTiming) []models.WordTiming {
+	split := make([]models.WordTiming, 0, len(wordTimings))
+	for _, timing := range wordTimings {
+		words := strings.Fields(timing.Word)
+		if len(words) <= 1 || hasUnspacedScript(timing.Word) {
+			timing.ID = len(split)
+			split = append(split, timing)
+			continue
+		}
+
+		chars := 0
+		for _, word := range words {
+			chars += utf8.RuneCountInString(word)
+		}
+
+		end := timing.StartTime + timing.DurationMs
+		done := 0
+		for i, word := range words {
+			start := timing.StartTime + timing.DurationMs*done/chars
+			done += utf8.RuneCountInString(word)
+			next := timing.StartTime + timing.DurationMs*done/chars
+			if i == len(words)-1 {
+				next = end
+			}
+
+			split = append(split, models.WordTiming{
+				ID:         len(split),
+				Word:       word,
+				StartTime:  start,
+				DurationMs: next - start,
+				Position:   timing.Position,
+				Confidence: timing.Confidence,
+			})
+		}
+	}
+	return split
+}
+
+// hasUnspacedScript reports whether text contains a script that doesn't separate
+// words with spaces
+func hasUnspacedScript(text string) bool {
+	for _, r := range text {
+		if unicode.In(r, unspacedScripts...) {
+			return true
+		}
+	}
+	return false
+}
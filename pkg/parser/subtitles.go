@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+
+	"yt_enhancer/pkg/models"
+)
+
+// SubtitlesToWordTimings explodes subtitle blocks back into pseudo word timings so
+// hand-made captions can be re-segmented. Each block's words are spread evenly across
+// its time span. Chinese and Japanese text is split per character since it has no
+// spaces between words; every other language is split on whitespace.
+func SubtitlesToWordTimings(subs []models.Subtitle, lang string) []models.WordTiming {
+	var wordTimings []models.WordTiming
+
+	for _, sub := range subs {
+		words := splitWords(sub.Text, lang)
+		duration := sub.EndMs - sub.StartMs
+		if duration < 0 {
+			duration = 0
+		}
+
+		for i, word := range words {
+			wordTimings = append(wordTimings, models.WordTiming{
+				ID:        len(wordTimings),
+				Word:      word,
+				StartTime: sub.StartMs + duration*i/len(words),
+			})
+		}
+	}
+
+	return wordTimings
+}
+
+// splitWords splits subtitle text into words according to the language's conventions
+func splitWords(text, lang string) []string {
+	switch strings.ToLower(strings.SplitN(lang, "-", 2)[0]) {
+	case "zh", "ja":
+		var words []string
+		for _, r := range text {
+			if !unicode.IsSpace(r) {
+				words = append(words, string(r))
+			}
+		}
+		return words
+	default:
+		return strings.Fields(text)
+	}
+}
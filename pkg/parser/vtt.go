@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"yt_enhancer/pkg/models"
+)
+
+// vttTagPattern matches inline cue tags such as <c>, </c> and <00:00:01.234>
+var vttTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// ParseVTTFile reads a WebVTT file and returns its cues with inline tags removed.
+// NOTE, STYLE and REGION blocks are skipped.
+func ParseVTTFile(filePath string) ([]models.Subtitle, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	return parseVTT(data)
+}
+
+// parseVTT parses WebVTT data
+func parseVTT(data []byte) ([]models.Subtitle, error) {
+	content := strings.ReplaceAll(string(trimBOM(data)), "\r\n", "\n")
+	var subs []models.Subtitle
+
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+
+		// Find the timing line; an optional cue identifier may precede it
+		timing := -1
+		for i, line := range lines {
+			if strings.Contains(line, "-->") {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+
+		start, end, err := parseVTTTiming(lines[timing])
+		if err != nil {
+			return nil, err
+		}
+
+		var text []string
+		for _, line := range lines[timing+1:] {
+			line = strings.TrimSpace(vttTagPattern.ReplaceAllString(line, ""))
+			if line != "" {
+				text = append(text, line)
+			}
+		}
+		if len(text) == 0 {
+			continue
+		}
+
+		subs = append(subs, models.Subtitle{
+			StartMs: start,
+			EndMs:   end,
+			Text:    strings.Join(text, " "),
+		})
+	}
+
+	return subs, nil
+}
+
+// parseVTTTiming parses a cue timing line such as "00:00:01.000 --> 00:00:02.500 align:start"
+func parseVTTTiming(line string) (int, int, error) {
+	parts := strings.SplitN(line, "-->", 2)
+	start, err := parseVTTTimestamp(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("invalid cue timing: %q", line)
+	}
+	end, err := parseVTTTimestamp(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// parseVTTTimestamp converts "hh:mm:ss.ttt" or "mm:ss.ttt" to milliseconds
+func parseVTTTimestamp(ts string) (int, error) {
+	secPart, msPart, ok := strings.Cut(ts, ".")
+	if !ok {
+		return 0, fmt.Errorf("invalid timestamp: %q", ts)
+	}
+	ms, err := strconv.Atoi(msPart)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp: %q", ts)
+	}
+
+	total := 0
+	for _, field := range strings.Split(secPart, ":") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp: %q", ts)
+		}
+		total = total*60 + n
+	}
+
+	return total*1000 + ms, nil
+}
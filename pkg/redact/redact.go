@@ -0,0 +1,84 @@
+package redact
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"yt_enhancer/pkg/models"
+)
+
+// DefaultPatterns match email addresses and phone numbers
+var DefaultPatterns = []string{
+	`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	`\+?\d[\d\-\s().]{7,}\d`,
+}
+
+// Redactor replaces sensitive text in transcript words with placeholders
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// Mapping maps placeholders back to the original text they replaced
+type Mapping map[string]string
+
+// New creates a Redactor from regular expression patterns
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// LoadPatterns reads redaction patterns from a file, one regular expression per
+// line. Empty lines and lines starting with # are ignored.
+func LoadPatterns(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading redaction patterns: %w", err)
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
+// Redact returns a copy of words with every pattern match replaced by a numbered
+// placeholder, along with the mapping needed to restore the original text
+func (r *Redactor) Redact(words []models.WordTiming) ([]models.WordTiming, Mapping) {
+	mapping := make(Mapping)
+	redacted := make([]models.WordTiming, len(words))
+
+	for i, word := range words {
+		for _, re := range r.patterns {
+			word.Word = re.ReplaceAllStringFunc(word.Word, func(match string) string {
+				placeholder := fmt.Sprintf("[PII%d]", len(mapping)+1)
+				mapping[placeholder] = match
+				return placeholder
+			})
+		}
+		redacted[i] = word
+	}
+
+	return redacted, mapping
+}
+
+// Restore replaces placeholders in text with the original text they stood for
+func (m Mapping) Restore(text string) string {
+	for placeholder, original := range m {
+		text = strings.ReplaceAll(text, placeholder, original)
+	}
+	return text
+}
@@ -0,0 +1,96 @@
+package subtitle
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"yt_enhancer/pkg/models"
+)
+
+// ASS canvas size; positions are given in percent and scaled to this resolution
+const (
+	assPlayResX = 1920
+	assPlayResY = 1080
+)
+
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: %d
+PlayResY: %d
+WrapStyle: 0
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Arial,54,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,2,1,2,60,60,50,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+// WriteASS writes subtitles to an ASS (Advanced SubStation Alpha) file. Subtitles
+// with a source position get matching \an alignment and \pos tags; the rest use the
+// default bottom-center style.
+func WriteASS(subtitles []models.Subtitle, outputPath string) error {
+	return writeFile(outputPath, func(w io.Writer) error {
+		return WriteASSTo(w, subtitles)
+	})
+}
+
+// WriteASSTo writes subtitles in ASS format to w
+func WriteASSTo(w io.Writer, subtitles []models.Subtitle) error {
+	var assBuilder strings.Builder
+
+	assBuilder.WriteString(fmt.Sprintf(assHeader, assPlayResX, assPlayResY))
+
+	for _, subtitle := range subtitles {
+		startTime := millisecondsToASSTimestamp(subtitle.StartMs)
+		endTime := millisecondsToASSTimestamp(subtitle.EndMs)
+
+		assBuilder.WriteString(fmt.Sprintf("Dialogue: 0,%s,%s,Default,,0,0,0,,%s%s\n",
+			startTime, endTime, assPositionTags(subtitle.Position), escapeASSText(subtitle.Text)))
+	}
+
+	_, err := io.WriteString(w, assBuilder.String())
+	return err
+}
+
+// assPositionTags converts a caption position into ASS override tags
+func assPositionTags(pos *models.Position) string {
+	if pos == nil || pos.AnchorPoint < 0 || pos.AnchorPoint > 8 {
+		return ""
+	}
+
+	// srv3 anchor points run row-major from the top-left, while ASS alignment
+	// follows the numpad layout (7-9 top, 4-6 middle, 1-3 bottom)
+	row := pos.AnchorPoint / 3
+	col := pos.AnchorPoint % 3
+	alignment := (2-row)*3 + col + 1
+
+	x := pos.X * assPlayResX / 100
+	y := pos.Y * assPlayResY / 100
+	return fmt.Sprintf("{\\an%d\\pos(%d,%d)}", alignment, x, y)
+}
+
+// escapeASSText converts newlines to ASS line breaks, neutralizes override braces
+// and turns <b>, <i> and <u> tags into override codes
+func escapeASSText(text string) string {
+	text = strings.ReplaceAll(text, "{", "(")
+	text = strings.ReplaceAll(text, "}", ")")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, tag := range inlineTags {
+		text = strings.ReplaceAll(text, "<"+tag+">", `{\`+tag+"1}")
+		text = strings.ReplaceAll(text, "</"+tag+">", `{\`+tag+"0}")
+	}
+	return strings.ReplaceAll(text, "\n", "\\N")
+}
+
+// Helper function to convert milliseconds to ASS timestamp format (H:MM:SS.cc)
+func millisecondsToASSTimestamp(ms int) string {
+	hours := ms / 3600000
+	minutes := ms / 60000 % 60
+	seconds := ms / 1000 % 60
+	centiseconds := ms % 1000 / 10
+
+	return fmt.Sprintf("%d:%02d:%02d.%02d", hours, minutes, seconds, centiseconds)
+}
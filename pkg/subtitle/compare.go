@@ -0,0 +1,260 @@
+package subtitle
+
+import (
+	"strings"
+	"unicode"
+
+	"yt_enhancer/pkg/models"
+)
+
+// TextChange is a block that differs between two subtitle tracks
+type TextChange struct {
+	Before int // Index of the block in the first track, -1 if it was added
+	After  int // Index of the block in the second track, -1 if it was removed
+}
+
+// ChangedTexts compares two subtitle tracks and returns the blocks whose trimmed
+// text differs. The tracks are aligned on their longest common run of unchanged
+// blocks first, so a block added or removed near the start doesn't make every
+// later block count as changed. The unmatched blocks between two matched ones are
+// paired in order, and any left over were added or removed.
+func ChangedTexts(before, after []models.Subtitle) []TextChange {
+	beforeKeys, afterKeys := trimmedTexts(before), trimmedTexts(after)
+
+	// Skip the blocks both tracks start and end with
+	start := 0
+	for start < len(beforeKeys) && start < len(afterKeys) && beforeKeys[start] == afterKeys[start] {
+		start++
+	}
+	endBefore, endAfter := len(beforeKeys), len(afterKeys)
+	for endBefore > start && endAfter > start && beforeKeys[endBefore-1] == afterKeys[endAfter-1] {
+		endBefore--
+		endAfter--
+	}
+	b, a := beforeKeys[start:endBefore], afterKeys[start:endAfter]
+
+	// lcs[i][j] is the length of the longest common subsequence of b[i:] and a[j:]
+	lcs := make([][]int, len(b)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(a)+1)
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		for j := len(a) - 1; j >= 0; j-- {
+			if b[i] == a[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var changes []TextChange
+	var removed, added []int
+	flush := func() {
+		for k := 0; k < max(len(removed), len(added)); k++ {
+			change := TextChange{Before: -1, After: -1}
+			if k < len(removed) {
+				change.Before = removed[k]
+			}
+			if k < len(added) {
+				change.After = added[k]
+			}
+			changes = append(changes, change)
+		}
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < len(b) || j < len(a) {
+		switch {
+		case i < len(b) && j < len(a) && b[i] == a[j]:
+			flush()
+			i++
+			j++
+		case j == len(a) || (i < len(b) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, start+i)
+			i++
+		default:
+			added = append(added, start+j)
+			j++
+		}
+	}
+	flush()
+
+	return changes
+}
+
+// trimmedTexts returns the trimmed text of each subtitle
+func trimmedTexts(subs []models.Subtitle) []string {
+	texts := make([]string, len(subs))
+	for i, sub := range subs {
+		texts[i] = strings.TrimSpace(sub.Text)
+	}
+	return texts
+}
+
+// PreservationScore returns the fraction of source words that appear, in order, in
+// the subtitle text. Case, spacing and punctuation are ignored, so a score of 1 means
+// the model fixed formatting without dropping or replacing any words.
+func PreservationScore(words []models.WordTiming, subtitles []models.Subtitle) float64 {
+	if len(words) == 0 {
+		return 1
+	}
+
+	var text strings.Builder
+	for _, sub := range subtitles {
+		text.WriteString(normalizeForMatch(sub.Text))
+	}
+	output := text.String()
+
+	found := 0
+	pos := 0
+	for _, word := range words {
+		w := normalizeForMatch(word.Word)
+		if w == "" {
+			found++
+			continue
+		}
+		if idx := strings.Index(output[pos:], w); idx != -1 {
+			found++
+			pos += idx + len(w)
+		}
+	}
+
+	return float64(found) / float64(len(words))
+}
+
+// normalizeForMatch lowercases text, drops tags and keeps only letters, marks and
+// digits
+func normalizeForMatch(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(StripTags(text)) {
+		if unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// AddedWords lists the words of a subtitle block that aren't among its source words
+type AddedWords struct {
+	Block int      // Index of the block in the subtitles
+	Words []string // Words of the block's text that weren't spoken during it
+}
+
+// FindAddedWords returns the blocks whose text has words the model added, checked
+// against each block's source words (see blockWords). Case, spacing
+// and punctuation are ignored, and a word may join several adjacent source words,
+// as in "well-known" for "well known". Words in scripts written without spaces,
+// such as Thai, only need to appear somewhere in the joined source words, since
+// the model is free to place spaces between them differently.
+func FindAddedWords(subs []models.Subtitle, words []models.WordTiming) []AddedWords {
+	var added []AddedWords
+	for i, sub := range subs {
+		var source []string
+		for _, word := range blockWords(sub, words) {
+			for _, token := range strings.Fields(word.Word) {
+				if norm := normalizeForMatch(token); norm != "" {
+					source = append(source, norm)
+				}
+			}
+		}
+		joined := strings.Join(source, "")
+
+		var unknown []string
+		for _, token := range strings.Fields(sub.Text) {
+			norm := normalizeForMatch(token)
+			if norm == "" || joinsSourceWords(norm, source) {
+				continue
+			}
+			if hasUnspacedScript(norm) && strings.Contains(joined, norm) {
+				continue
+			}
+			unknown = append(unknown, token)
+		}
+
+		if len(unknown) > 0 {
+			added = append(added, AddedWords{Block: i, Words: unknown})
+		}
+	}
+	return added
+}
+
+// blockWords returns the source words of a block: those in its word range when
+// known, or else those starting within its time range. The time range can miss a
+// word when the block was trimmed to make room for the next one, and can take in
+// the next block's first word, so it is only a fallback.
+func blockWords(sub models.Subtitle, words []models.WordTiming) []models.WordTiming {
+	var found []models.WordTiming
+	for _, word := range words {
+		if sub.WordCount > 0 {
+			if word.ID >= sub.FirstWord && word.ID < sub.FirstWord+sub.WordCount {
+				found = append(found, word)
+			}
+		} else if word.StartTime >= sub.StartMs && word.StartTime <= sub.EndMs {
+			found = append(found, word)
+		}
+	}
+	return found
+}
+
+// joinsSourceWords reports whether token is one or more adjacent source words
+// joined together
+func joinsSourceWords(token string, source []string) bool {
+	for start := range source {
+		joined := ""
+		for _, word := range source[start:] {
+			joined += word
+			if len(joined) >= len(token) {
+				break
+			}
+		}
+		if joined == token {
+			return true
+		}
+	}
+	return false
+}
+
+// unspacedScripts are scripts written without spaces between words
+var unspacedScripts = []*unicode.RangeTable{
+	unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar,
+	unicode.Han, unicode.Hiragana, unicode.Katakana,
+}
+
+// hasUnspacedScript reports whether text contains a script that doesn't separate
+// words with spaces
+func hasUnspacedScript(text string) bool {
+	for _, r := range text {
+		if unicode.In(r, unspacedScripts...) {
+			return true
+		}
+	}
+	return false
+}
+
+// UncertainWords lists the source words of a subtitle block that were recognized
+// with low confidence
+type UncertainWords struct {
+	Block int      // Index of the block in the subtitles
+	Words []string // Uncertain source words spoken during the block
+}
+
+// FindUncertainWords returns the blocks whose source words (see blockWords)
+// include words marked uncertain, so reviewers know which parts of the transcript
+// to check
+func FindUncertainWords(subs []models.Subtitle, words []models.WordTiming) []UncertainWords {
+	var uncertain []UncertainWords
+	for i, sub := range subs {
+		var found []string
+		for _, word := range blockWords(sub, words) {
+			if word.Uncertain {
+				found = append(found, word.Word)
+			}
+		}
+		if len(found) > 0 {
+			uncertain = append(uncertain, UncertainWords{Block: i, Words: found})
+		}
+	}
+	return uncertain
+}
@@ -0,0 +1,151 @@
+package subtitle
+
+import (
+	"reflect"
+	"testing"
+
+	"yt_enhancer/pkg/models"
+)
+
+func TestFindAddedWords(t *testing.T) {
+	words := []models.WordTiming{
+		{ID: 0, Word: "I", StartTime: 0},
+		{ID: 1, Word: "like", StartTime: 300},
+		{ID: 2, Word: "green", StartTime: 600},
+		{ID: 3, Word: "tea.", StartTime: 900},
+		{ID: 4, Word: "It", StartTime: 1200},
+		{ID: 5, Word: "helps.", StartTime: 1500},
+	}
+
+	tests := []struct {
+		name string
+		sub  models.Subtitle
+		want []AddedWords
+	}{
+		{
+			// The block was trimmed to end before its last word starts
+			name: "last word outside the time range",
+			sub:  models.Subtitle{StartMs: 0, EndMs: 800, Text: "I like green tea.", FirstWord: 0, WordCount: 4},
+		},
+		{
+			name: "next block's word inside the time range",
+			sub:  models.Subtitle{StartMs: 0, EndMs: 1300, Text: "I like green tea. It", FirstWord: 0, WordCount: 4},
+			want: []AddedWords{{Block: 0, Words: []string{"It"}}},
+		},
+		{
+			name: "added word",
+			sub:  models.Subtitle{StartMs: 0, EndMs: 1100, Text: "I really like green tea.", FirstWord: 0, WordCount: 4},
+			want: []AddedWords{{Block: 0, Words: []string{"really"}}},
+		},
+		{
+			name: "joined source words",
+			sub:  models.Subtitle{StartMs: 1200, EndMs: 2000, Text: "It-helps.", FirstWord: 4, WordCount: 2},
+		},
+		{
+			name: "time range without a word range",
+			sub:  models.Subtitle{StartMs: 0, EndMs: 800, Text: "I like green tea."},
+			want: []AddedWords{{Block: 0, Words: []string{"tea."}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindAddedWords([]models.Subtitle{tt.sub}, words)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindAddedWords = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindUncertainWords(t *testing.T) {
+	words := []models.WordTiming{
+		{ID: 0, Word: "I", StartTime: 0},
+		{ID: 1, Word: "like", StartTime: 300, Uncertain: true},
+		{ID: 2, Word: "tea.", StartTime: 600, Uncertain: true},
+	}
+	subs := []models.Subtitle{
+		{StartMs: 0, EndMs: 700, Text: "I like", FirstWord: 0, WordCount: 2},
+		{StartMs: 800, EndMs: 1500, Text: "tea.", FirstWord: 2, WordCount: 1},
+	}
+
+	want := []UncertainWords{
+		{Block: 0, Words: []string{"like"}},
+		{Block: 1, Words: []string{"tea."}},
+	}
+	if got := FindUncertainWords(subs, words); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindUncertainWords = %+v, want %+v", got, want)
+	}
+}
+
+func TestChangedTexts(t *testing.T) {
+	track := func(texts ...string) []models.Subtitle {
+		subs := make([]models.Subtitle, len(texts))
+		for i, text := range texts {
+			subs[i] = models.Subtitle{StartMs: i * 1000, EndMs: i*1000 + 900, Text: text}
+		}
+		return subs
+	}
+
+	tests := []struct {
+		name   string
+		before []models.Subtitle
+		after  []models.Subtitle
+		want   []TextChange
+	}{
+		{
+			name:   "unchanged apart from spacing",
+			before: track("a", "b", "c"),
+			after:  track("a ", " b", "c"),
+		},
+		{
+			name:   "changed text",
+			before: track("a", "b", "c"),
+			after:  track("a", "B", "c"),
+			want:   []TextChange{{Before: 1, After: 1}},
+		},
+		{
+			// Only the added block differs, not every block after it
+			name:   "block added near the start",
+			before: track("a", "b", "c", "d"),
+			after:  track("a", "x", "b", "c", "d"),
+			want:   []TextChange{{Before: -1, After: 1}},
+		},
+		{
+			name:   "block removed near the start",
+			before: track("a", "b", "c", "d"),
+			after:  track("a", "c", "d"),
+			want:   []TextChange{{Before: 1, After: -1}},
+		},
+		{
+			name:   "block split in two",
+			before: track("a", "b c", "d"),
+			after:  track("a", "b", "c", "d"),
+			want:   []TextChange{{Before: 1, After: 1}, {Before: -1, After: 2}},
+		},
+		{
+			name:   "changes in several places",
+			before: track("a", "b", "c", "d", "e"),
+			after:  track("x", "b", "c", "e", "f"),
+			want: []TextChange{
+				{Before: 0, After: 0},
+				{Before: 3, After: -1},
+				{Before: -1, After: 4},
+			},
+		},
+		{
+			name:  "empty before",
+			after: track("a"),
+			want:  []TextChange{{Before: -1, After: 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ChangedTexts(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedTexts = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package subtitle
+
+import (
+	"strings"
+
+	"yt_enhancer/pkg/models"
+)
+
+// BlockReport describes one subtitle block for spot-checking the model's output
+type BlockReport struct {
+	Block     int     // Index of the block in the subtitles
+	StartMs   int     // Start time of the block
+	EndMs     int     // End time of the block
+	Chars     int     // Characters a viewer has to read, without tags
+	CPS       float64 // Characters read per second, 0 for a block with no duration
+	FirstWord int     // Index of the first source word spoken during the block, -1 if none
+	LastWord  int     // Index of the last source word spoken during the block, -1 if none
+	Text      string  // Text of the block
+}
+
+// ReportBlocks returns the diagnostics of each subtitle block. Blocks are matched
+// to the source words starting within their time range, so the subtitles must
+// still be in the source's time base.
+func ReportBlocks(subs []models.Subtitle, words []models.WordTiming) []BlockReport {
+	reports := make([]BlockReport, len(subs))
+	for i, sub := range subs {
+		report := BlockReport{
+			Block:     i,
+			StartMs:   sub.StartMs,
+			EndMs:     sub.EndMs,
+			Chars:     CountReadingChars(strings.TrimSpace(StripTags(sub.Text))),
+			FirstWord: -1,
+			LastWord:  -1,
+			Text:      sub.Text,
+		}
+		if duration := sub.EndMs - sub.StartMs; duration > 0 {
+			report.CPS = float64(report.Chars) * 1000 / float64(duration)
+		}
+
+		for _, word := range words {
+			if word.StartTime < sub.StartMs || word.StartTime > sub.EndMs {
+				continue
+			}
+			if report.FirstWord == -1 {
+				report.FirstWord = word.ID
+			}
+			report.LastWord = word.ID
+		}
+		reports[i] = report
+	}
+	return reports
+}
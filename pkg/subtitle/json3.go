@@ -0,0 +1,55 @@
+package subtitle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"yt_enhancer/pkg/models"
+)
+
+// json3Document is YouTube's json3 caption format, as read by parser.ParseJSON3File
+type json3Document struct {
+	Events []json3Event `json:"events"`
+}
+
+type json3Event struct {
+	TStartMs    int        `json:"tStartMs"`
+	DDurationMs int        `json:"dDurationMs"`
+	Segs        []json3Seg `json:"segs"`
+}
+
+type json3Seg struct {
+	UTF8 string `json:"utf8"`
+}
+
+// WriteJSON3 writes subtitles to a YouTube json3 file, which can be uploaded back
+// to YouTube
+func WriteJSON3(subtitles []models.Subtitle, outputPath string) error {
+	return writeFile(outputPath, func(w io.Writer) error {
+		return WriteJSON3To(w, subtitles)
+	})
+}
+
+// WriteJSON3To writes subtitles in YouTube json3 format to w, one event with a
+// single segment per subtitle. Inline tags are dropped, since json3 styles text
+// with pens instead.
+func WriteJSON3To(w io.Writer, subtitles []models.Subtitle) error {
+	doc := json3Document{Events: make([]json3Event, 0, len(subtitles))}
+	for _, sub := range subtitles {
+		doc.Events = append(doc.Events, json3Event{
+			TStartMs:    sub.StartMs,
+			DDurationMs: max(sub.EndMs-sub.StartMs, 0),
+			Segs:        []json3Seg{{UTF8: StripTags(sub.Text)}},
+		})
+	}
+
+	// Keep characters like < and & readable instead of \u escapes
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("error marshaling JSON3: %w", err)
+	}
+	return nil
+}
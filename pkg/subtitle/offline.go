@@ -0,0 +1,45 @@
+package subtitle
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"yt_enhancer/pkg/models"
+)
+
+const (
+	offlineClauseWords = 8  // Words after which a block may end at a comma or similar
+	offlineMaxWords    = 20 // Words after which a block always ends
+)
+
+// InferBreaks groups words into sentence-like blocks without a model. A block ends
+// after sentence-ending punctuation, before a gap of at least maxGapMs between one
+// word's end and the next word's start (0 disables), or after clause punctuation
+// such as a comma once it has offlineClauseWords words. Blocks never grow past
+// offlineMaxWords words. Words are kept as they are.
+func InferBreaks(words []models.WordTiming, maxGapMs int) [][]models.WordTiming {
+	var groups [][]models.WordTiming
+	var current []models.WordTiming
+	for _, word := range words {
+		if len(current) > 0 {
+			prev := current[len(current)-1]
+			gap := maxGapMs > 0 && word.StartTime-(prev.StartTime+prev.DurationMs) >= maxGapMs
+			clause := len(current) >= offlineClauseWords && endsClause(prev.Word)
+			if gap || clause || endsSentence(prev.Word) || len(current) >= offlineMaxWords {
+				groups = append(groups, current)
+				current = nil
+			}
+		}
+		current = append(current, word)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// endsClause reports whether word ends with punctuation that separates clauses
+func endsClause(word string) bool {
+	r, _ := utf8.DecodeLastRuneInString(strings.TrimRight(StripTags(word), `"')]»”’`))
+	return strings.ContainsRune(",;:，、；：—", r)
+}
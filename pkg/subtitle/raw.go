@@ -0,0 +1,117 @@
+package subtitle
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"yt_enhancer/pkg/models"
+)
+
+// GroupOptions controls how GroupWords groups words into blocks
+type GroupOptions struct {
+	MaxWords      int // Start a new block after this many words (0 disables)
+	MaxDurationMs int // Start a new block once a block spans this long (0 disables)
+	PauseMs       int // Start a new block after a pause this long between words (0 disables)
+	MinDurationMs int // Keep blocks on screen at least this long, if the next block allows
+	GapMs         int // Gap kept before the next block's start
+	LastWordPadMs int // Display time after the last word's start when its duration is unknown
+}
+
+// GroupWords converts word timings straight into subtitle blocks, without a model.
+// Words are added to a block until it ends a sentence, reaches the word or duration
+// limit, or the speaker pauses. Each block lasts until the next block's start minus
+// the gap; before a pause, or at the end, it lasts until its last word ends
+// instead, but at least MinDurationMs where the next block leaves room. The source
+// text is kept as is.
+func GroupWords(words []models.WordTiming, opts GroupOptions) []models.Subtitle {
+	var groups [][]models.WordTiming
+	var current []models.WordTiming
+	for _, word := range words {
+		if len(current) > 0 {
+			prev := current[len(current)-1]
+			full := opts.MaxWords > 0 && len(current) >= opts.MaxWords
+			long := opts.MaxDurationMs > 0 && word.StartTime-current[0].StartTime >= opts.MaxDurationMs
+			if full || long || isPause(prev, word, opts) || endsSentence(prev.Word) {
+				groups = append(groups, current)
+				current = nil
+			}
+		}
+		current = append(current, word)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return TimeGroups(groups, opts)
+}
+
+// TimeGroups turns groups of consecutive words into subtitle blocks timed as
+// GroupWords times them. Only the pause, minimum duration, gap and last word
+// padding options apply.
+func TimeGroups(groups [][]models.WordTiming, opts GroupOptions) []models.Subtitle {
+	subtitles := make([]models.Subtitle, 0, len(groups))
+	for i, group := range groups {
+		first, last := group[0], group[len(group)-1]
+
+		endMs := last.StartTime + last.DurationMs
+		if last.DurationMs == 0 {
+			endMs = last.StartTime + opts.LastWordPadMs
+		}
+		endMs = max(endMs, first.StartTime+opts.MinDurationMs)
+		if i+1 < len(groups) {
+			next := groups[i+1][0]
+			limit := next.StartTime - opts.GapMs
+			if !isPause(last, next, opts) {
+				endMs = limit
+			}
+			endMs = min(endMs, limit)
+		}
+		if endMs <= first.StartTime {
+			endMs = max(last.StartTime, first.StartTime+1)
+		}
+
+		subtitles = append(subtitles, models.Subtitle{
+			StartMs:   first.StartTime,
+			EndMs:     endMs,
+			Text:      joinWords(group),
+			Position:  first.Position,
+			FirstWord: first.ID,
+			WordCount: len(group),
+		})
+	}
+	return subtitles
+}
+
+// isPause reports whether the speaker pauses between word and next: the gap from
+// the end of word, or its start if its duration is unknown, is at least PauseMs
+func isPause(word, next models.WordTiming, opts GroupOptions) bool {
+	return opts.PauseMs > 0 && next.StartTime-(word.StartTime+word.DurationMs) >= opts.PauseMs
+}
+
+// endsSentence reports whether word ends with sentence-ending punctuation
+func endsSentence(word string) bool {
+	r, _ := utf8.DecodeLastRuneInString(strings.TrimRight(StripTags(word), `"')]»”’`))
+	return strings.ContainsRune(".!?。！？…", r)
+}
+
+// joinWords joins the words of a block with spaces, except between Chinese or
+// Japanese characters, which are written without them
+func joinWords(words []models.WordTiming) string {
+	var b strings.Builder
+	for i, word := range words {
+		if i > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(words[i-1].Word)
+			next, _ := utf8.DecodeRuneInString(word.Word)
+			if !isCJK(prev) || !isCJK(next) {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(word.Word)
+	}
+	return b.String()
+}
+
+// isCJK reports whether r is a Chinese or Japanese character
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
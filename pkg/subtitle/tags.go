@@ -0,0 +1,142 @@
+package subtitle
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"yt_enhancer/pkg/models"
+)
+
+// tagPattern matches an HTML-style tag such as <i>, </b> or <font color="red">
+var tagPattern = regexp.MustCompile(`</?([a-zA-Z]+)[^<>]*>`)
+
+// inlineTags are the emphasis tags kept in subtitle text; SRT players and WebVTT
+// both understand them
+var inlineTags = []string{"b", "i", "u"}
+
+// Directional formatting characters that mark a line as right-to-left
+const (
+	rtlEmbedding = "‫"
+	popFormat    = "‬"
+)
+
+// StripTags removes the <b>, <i> and <u> tags from text
+func StripTags(text string) string {
+	return tagPattern.ReplaceAllStringFunc(text, func(tag string) string {
+		if isInlineTag(strings.ToLower(tagPattern.FindStringSubmatch(tag)[1])) {
+			return ""
+		}
+		return tag
+	})
+}
+
+// CleanTags keeps only the <b>, <i> and <u> tags in the subtitles' text and
+// balances them, closing spans left open at the end of a block and dropping
+// stray closing tags, since a span can be split across blocks. Spans of adjacent
+// words, like "<i>one</i> <i>two</i>", are joined into one.
+func CleanTags(subtitles []models.Subtitle) []models.Subtitle {
+	result := make([]models.Subtitle, len(subtitles))
+	for i, sub := range subtitles {
+		sub.Text = joinSpans(balanceTags(sub.Text))
+		result[i] = sub
+	}
+	return result
+}
+
+// balanceTags drops tags other than inlineTags from text and balances the rest
+func balanceTags(text string) string {
+	var b strings.Builder
+	var open []string
+	last := 0
+	for _, m := range tagPattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(text[last:m[0]])
+		last = m[1]
+
+		tag := strings.ToLower(text[m[2]:m[3]])
+		if !isInlineTag(tag) {
+			continue
+		}
+		if text[m[0]+1] != '/' {
+			open = append(open, tag)
+			b.WriteString("<" + tag + ">")
+			continue
+		}
+
+		// Close the span and any opened inside it; drop a closer without a span
+		at := -1
+		for j := len(open) - 1; j >= 0; j-- {
+			if open[j] == tag {
+				at = j
+				break
+			}
+		}
+		if at < 0 {
+			continue
+		}
+		for j := len(open) - 1; j >= at; j-- {
+			b.WriteString("</" + open[j] + ">")
+		}
+		open = open[:at]
+	}
+	b.WriteString(text[last:])
+
+	for j := len(open) - 1; j >= 0; j-- {
+		b.WriteString("</" + open[j] + ">")
+	}
+	return b.String()
+}
+
+// joinSpans joins spans of the same tag separated only by spaces
+func joinSpans(text string) string {
+	for {
+		joined := text
+		for _, tag := range inlineTags {
+			joined = strings.ReplaceAll(joined, "</"+tag+"> <"+tag+">", " ")
+			joined = strings.ReplaceAll(joined, "</"+tag+"><"+tag+">", "")
+		}
+		if joined == text {
+			return text
+		}
+		text = joined
+	}
+}
+
+// isInlineTag reports whether tag is one of inlineTags
+func isInlineTag(tag string) bool {
+	for _, t := range inlineTags {
+		if tag == t {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkRTL wraps each line of the subtitles' text that reads right to left, such as
+// Arabic or Hebrew, in Unicode directional embedding characters, so players that
+// lay lines out left to right keep its punctuation at the correct end
+func MarkRTL(subtitles []models.Subtitle) []models.Subtitle {
+	result := make([]models.Subtitle, len(subtitles))
+	for i, sub := range subtitles {
+		lines := strings.Split(sub.Text, "\n")
+		for j, line := range lines {
+			if isRTL(line) && !strings.HasPrefix(line, rtlEmbedding) {
+				lines[j] = rtlEmbedding + line + popFormat
+			}
+		}
+		sub.Text = strings.Join(lines, "\n")
+		result[i] = sub
+	}
+	return result
+}
+
+// isRTL reports whether the first letter of text, ignoring tags, is in a
+// right-to-left script
+func isRTL(text string) bool {
+	for _, r := range StripTags(text) {
+		if unicode.IsLetter(r) {
+			return unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko)
+		}
+	}
+	return false
+}
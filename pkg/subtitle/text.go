@@ -0,0 +1,77 @@
+package subtitle
+
+import (
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"yt_enhancer/pkg/models"
+)
+
+// paragraphGapMs is the silence between blocks that starts a new paragraph in a
+// plain-text transcript
+const paragraphGapMs = 3000
+
+// WriteText writes subtitles to outputPath as a plain-text transcript
+func WriteText(subtitles []models.Subtitle, outputPath string) error {
+	return writeFile(outputPath, func(w io.Writer) error {
+		return WriteTextTo(w, subtitles)
+	})
+}
+
+// WriteTextTo writes subtitles to w as a plain-text transcript without timings,
+// such as for a blog post. Blocks are joined into paragraphs with spaces, and a
+// pause of paragraphGapMs or more between blocks starts a new paragraph. Line
+// breaks added for display and inline tags are removed.
+func WriteTextTo(w io.Writer, subtitles []models.Subtitle) error {
+	var paragraphs []string
+	var paragraph strings.Builder
+	prevEndMs := 0
+	for i, sub := range subtitles {
+		text := joinLines(StripTags(sub.Text))
+		if text == "" {
+			continue
+		}
+		if i > 0 && sub.StartMs-prevEndMs >= paragraphGapMs && paragraph.Len() > 0 {
+			paragraphs = append(paragraphs, paragraph.String())
+			paragraph.Reset()
+		}
+		if paragraph.Len() > 0 {
+			paragraph.WriteString(" ")
+		}
+		paragraph.WriteString(text)
+		prevEndMs = sub.EndMs
+	}
+	if paragraph.Len() > 0 {
+		paragraphs = append(paragraphs, paragraph.String())
+	}
+
+	if len(paragraphs) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w, strings.Join(paragraphs, "\n\n")+"\n")
+	return err
+}
+
+// joinLines joins the lines of a block's text into one. Lines are joined with a
+// space, except where a line was broken inside a word of a script written without
+// spaces, such as Thai.
+func joinLines(text string) string {
+	var joined strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if joined.Len() > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(joined.String())
+			next, _ := utf8.DecodeRuneInString(line)
+			if !unicode.In(prev, unspacedScripts...) || !unicode.In(next, unspacedScripts...) {
+				joined.WriteString(" ")
+			}
+		}
+		joined.WriteString(line)
+	}
+	return joined.String()
+}
@@ -0,0 +1,69 @@
+package subtitle
+
+import (
+	"math"
+
+	"yt_enhancer/pkg/models"
+)
+
+// FilterRange keeps the subtitles that overlap the window from startMs to endMs,
+// clipping blocks that cross its bounds. An endMs of zero or less leaves the window
+// open-ended. With rebase, timings are moved so the window starts at zero, as for
+// a clip cut from the video at startMs.
+func FilterRange(subs []models.Subtitle, startMs, endMs int, rebase bool) []models.Subtitle {
+	var result []models.Subtitle
+	for _, sub := range subs {
+		if sub.EndMs <= startMs || (endMs > 0 && sub.StartMs >= endMs) {
+			continue
+		}
+
+		sub.StartMs = max(sub.StartMs, startMs)
+		if endMs > 0 {
+			sub.EndMs = min(sub.EndMs, endMs)
+		}
+		if rebase {
+			sub.StartMs -= startMs
+			sub.EndMs -= startMs
+		}
+		result = append(result, sub)
+	}
+	return result
+}
+
+// ShiftTiming moves every subtitle by deltaMs, later for a positive delta and
+// earlier for a negative one. Times are clamped at zero, and blocks that would end
+// before the video starts are dropped.
+func ShiftTiming(subs []models.Subtitle, deltaMs int) []models.Subtitle {
+	result := make([]models.Subtitle, 0, len(subs))
+	for _, sub := range subs {
+		sub.StartMs = max(sub.StartMs+deltaMs, 0)
+		sub.EndMs = max(sub.EndMs+deltaMs, 0)
+		if sub.EndMs == 0 {
+			continue
+		}
+		result = append(result, sub)
+	}
+	return result
+}
+
+// ScaleTiming stretches the subtitles' timings by factor around anchorMs, which
+// stays fixed: a time t becomes anchorMs + (t - anchorMs) * factor. This corrects
+// drift that grows over the video, e.g. a factor of 23.976/25 for subtitles timed
+// against 23.976 fps playing with a 25 fps encode. Times are clamped at zero, and
+// blocks that would end before the video starts are dropped.
+func ScaleTiming(subs []models.Subtitle, factor float64, anchorMs int) []models.Subtitle {
+	scale := func(ms int) int {
+		return max(anchorMs+int(math.Round(float64(ms-anchorMs)*factor)), 0)
+	}
+
+	result := make([]models.Subtitle, 0, len(subs))
+	for _, sub := range subs {
+		sub.StartMs = scale(sub.StartMs)
+		sub.EndMs = scale(sub.EndMs)
+		if sub.EndMs == 0 {
+			continue
+		}
+		result = append(result, sub)
+	}
+	return result
+}
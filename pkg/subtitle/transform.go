@@ -0,0 +1,380 @@
+package subtitle
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"yt_enhancer/pkg/models"
+)
+
+// InsertSilenceCues inserts placeholder cues into gaps between subtitles that are
+// longer than minGapMs. Each placeholder spans the whole gap and carries marker as
+// its text (which may be empty). A minGapMs of zero or less disables the pass.
+func InsertSilenceCues(subtitles []models.Subtitle, minGapMs int, marker string) []models.Subtitle {
+	if minGapMs <= 0 || len(subtitles) == 0 {
+		return subtitles
+	}
+
+	result := make([]models.Subtitle, 0, len(subtitles))
+	prevEnd := 0
+
+	for _, sub := range subtitles {
+		// Fill the gap since the previous cue (or the start of the video)
+		if sub.StartMs-prevEnd > minGapMs {
+			result = append(result, models.Subtitle{
+				StartMs: prevEnd,
+				EndMs:   sub.StartMs,
+				Text:    marker,
+			})
+		}
+
+		result = append(result, sub)
+		prevEnd = sub.EndMs
+	}
+
+	return result
+}
+
+// MergeDuplicates collapses runs of consecutive subtitles with identical (trimmed)
+// text into a single block spanning from the first start to the last end, as long
+// as each gap within the run is shorter than maxGapMs. A maxGapMs of zero or less
+// disables the pass.
+func MergeDuplicates(subtitles []models.Subtitle, maxGapMs int) []models.Subtitle {
+	if maxGapMs <= 0 || len(subtitles) == 0 {
+		return subtitles
+	}
+
+	result := make([]models.Subtitle, 0, len(subtitles))
+	for _, sub := range subtitles {
+		if n := len(result); n > 0 {
+			prev := &result[n-1]
+			if strings.TrimSpace(prev.Text) == strings.TrimSpace(sub.Text) && sub.StartMs-prev.EndMs < maxGapMs {
+				if sub.EndMs > prev.EndMs {
+					prev.EndMs = sub.EndMs
+				}
+				continue
+			}
+		}
+		result = append(result, sub)
+	}
+
+	return result
+}
+
+// minCueDurationMs is the shortest display time NormalizeTimeline leaves a block
+const minCueDurationMs = 300
+
+// NormalizeTimeline sorts subtitles by start time and makes each one end at least
+// gapMs before the next one starts. Blocks keep at least minCueDurationMs on screen:
+// when trimming would leave a block shorter, the next block starts later instead,
+// and if that one can't spare the time either the two are merged into one.
+func NormalizeTimeline(subs []models.Subtitle, gapMs int) []models.Subtitle {
+	if len(subs) == 0 {
+		return subs
+	}
+
+	sorted := make([]models.Subtitle, len(subs))
+	copy(sorted, subs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartMs < sorted[j].StartMs
+	})
+
+	result := []models.Subtitle{sorted[0]}
+	for _, sub := range sorted[1:] {
+		prev := &result[len(result)-1]
+		if prev.EndMs <= sub.StartMs-gapMs {
+			result = append(result, sub)
+			continue
+		}
+
+		// Trim the previous block if it stays long enough
+		if sub.StartMs-gapMs-prev.StartMs >= minCueDurationMs {
+			prev.EndMs = sub.StartMs - gapMs
+			result = append(result, sub)
+			continue
+		}
+
+		// Otherwise start this block later if it stays long enough
+		end := prev.StartMs + minCueDurationMs
+		if sub.EndMs-(end+gapMs) >= minCueDurationMs {
+			prev.EndMs = end
+			sub.StartMs = end + gapMs
+			result = append(result, sub)
+			continue
+		}
+
+		// Neither block can give up time, so show them together
+		prev.Text = strings.TrimSpace(prev.Text + " " + sub.Text)
+		prev.EndMs = max(prev.EndMs, sub.EndMs)
+		if prev.WordCount > 0 && sub.WordCount > 0 {
+			end := max(prev.FirstWord+prev.WordCount, sub.FirstWord+sub.WordCount)
+			prev.FirstWord = min(prev.FirstWord, sub.FirstWord)
+			prev.WordCount = end - prev.FirstWord
+		} else {
+			prev.WordCount = 0
+		}
+	}
+
+	return result
+}
+
+// CombineBilingual merges a source track and its translation into one track whose
+// text has the source on the first line and the translation on the second. When
+// both tracks have the same cue timings they are paired by index; otherwise each
+// translated cue is attached to the source cue it overlaps most in time, so
+// translations that split or merge blocks still line up. Source timings are kept.
+func CombineBilingual(source, translated []models.Subtitle) []models.Subtitle {
+	lines := make([][]string, len(source))
+
+	if sameTimings(source, translated) {
+		for i := range source {
+			lines[i] = append(lines[i], translated[i].Text)
+		}
+	} else {
+		for _, t := range translated {
+			best, bestOverlap := -1, 0
+			for i, sub := range source {
+				overlap := min(sub.EndMs, t.EndMs) - max(sub.StartMs, t.StartMs)
+				if overlap > bestOverlap {
+					best, bestOverlap = i, overlap
+				}
+			}
+			if best >= 0 {
+				lines[best] = append(lines[best], t.Text)
+			}
+		}
+	}
+
+	result := make([]models.Subtitle, len(source))
+	copy(result, source)
+	for i := range result {
+		translation := strings.TrimSpace(strings.Join(lines[i], " "))
+		if translation != "" && translation != strings.TrimSpace(result[i].Text) {
+			result[i].Text = strings.TrimSpace(result[i].Text) + "\n" + translation
+		}
+	}
+
+	return result
+}
+
+// sameTimings reports whether two tracks have the same number of cues with the
+// same start and end times
+func sameTimings(a, b []models.Subtitle) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].StartMs != b[i].StartMs || a[i].EndMs != b[i].EndMs {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitByChapters groups subtitles by the chapter their start time falls in. The
+// result has one (possibly empty) slice per chapter, in chapter order. Subtitles
+// starting before the first chapter are assigned to it.
+func SplitByChapters(subtitles []models.Subtitle, chapters []models.Chapter) [][]models.Subtitle {
+	parts := make([][]models.Subtitle, len(chapters))
+	if len(chapters) == 0 {
+		return parts
+	}
+
+	chapter := 0
+	for _, sub := range subtitles {
+		// Advance to the last chapter that starts at or before this subtitle
+		for chapter+1 < len(chapters) && chapters[chapter+1].StartMs <= sub.StartMs {
+			chapter++
+		}
+		parts[chapter] = append(parts[chapter], sub)
+	}
+
+	return parts
+}
+
+// abbreviations that legitimately end in a period and must keep it mid-sentence
+var abbreviations = map[string]bool{
+	"mr.": true, "mrs.": true, "ms.": true, "dr.": true, "prof.": true, "st.": true,
+	"vs.": true, "etc.": true, "e.g.": true, "i.e.": true, "no.": true, "jr.": true, "sr.": true,
+}
+
+// NormalizeSentencePunctuation makes cues that end a sentence end with terminal
+// punctuation and strips stray periods from cues that continue into the next one.
+// A cue ends a sentence when the next cue starts with an uppercase letter (or it is
+// the last cue) and continues one when the next cue starts with a lowercase letter.
+// Only text in scripts with letter case is touched; Thai and other caseless scripts,
+// which don't mark sentence ends this way, are left as is.
+func NormalizeSentencePunctuation(subtitles []models.Subtitle) []models.Subtitle {
+	result := make([]models.Subtitle, len(subtitles))
+	copy(result, subtitles)
+
+	for i := range result {
+		text := strings.TrimRightFunc(result[i].Text, unicode.IsSpace)
+		last, ok := lastLetter(text)
+		if !ok || !isCased(last) {
+			continue
+		}
+
+		sentenceEnd := i == len(result)-1
+		if !sentenceEnd {
+			first, ok := firstLetter(result[i+1].Text)
+			if !ok || !isCased(first) {
+				continue
+			}
+			sentenceEnd = unicode.IsUpper(first)
+		}
+
+		if sentenceEnd {
+			if !endsWithTerminal(text) {
+				result[i].Text = text + "."
+			}
+		} else if strings.HasSuffix(text, ".") && !strings.HasSuffix(text, "..") && !isAbbreviation(text) {
+			result[i].Text = strings.TrimSuffix(text, ".")
+		}
+	}
+
+	return result
+}
+
+// endsWithTerminal reports whether text ends with sentence-final punctuation,
+// allowing for closing quotes and brackets after it
+func endsWithTerminal(text string) bool {
+	text = strings.TrimRight(text, "\"')]»”’")
+	return strings.HasSuffix(text, ".") || strings.HasSuffix(text, "!") ||
+		strings.HasSuffix(text, "?") || strings.HasSuffix(text, "…")
+}
+
+// isAbbreviation reports whether the last token of text is an abbreviation or
+// contains inner periods (e.g. "U.S."), in which case its final period is kept
+func isAbbreviation(text string) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return false
+	}
+	token := strings.ToLower(fields[len(fields)-1])
+	return abbreviations[token] || strings.Count(token, ".") > 1
+}
+
+// firstLetter returns the first letter in text
+func firstLetter(text string) (rune, bool) {
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			return r, true
+		}
+		if unicode.IsDigit(r) {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// lastLetter returns the last letter in text
+func lastLetter(text string) (rune, bool) {
+	runes := []rune(text)
+	for i := len(runes) - 1; i >= 0; i-- {
+		if unicode.IsLetter(runes[i]) {
+			return runes[i], true
+		}
+	}
+	return 0, false
+}
+
+// isCased reports whether r belongs to a script with upper and lower case
+func isCased(r rune) bool {
+	return unicode.ToUpper(r) != unicode.ToLower(r)
+}
+
+// SplitLongBlocks splits subtitles lasting longer than maxDurationMs into as few
+// consecutive blocks as keep each one within the limit. The text is divided at word
+// boundaries, by the same rules as WrapLines, into parts of about equal length, and
+// each part gets a share of the block's time proportional to its characters. A
+// block with no word boundary to split at is kept whole. Blocks under the limit
+// pass through untouched, and a maxDurationMs of zero or less disables the pass.
+func SplitLongBlocks(subs []models.Subtitle, maxDurationMs int) []models.Subtitle {
+	if maxDurationMs <= 0 {
+		return subs
+	}
+
+	result := make([]models.Subtitle, 0, len(subs))
+	for _, sub := range subs {
+		duration := sub.EndMs - sub.StartMs
+		if duration <= maxDurationMs {
+			result = append(result, sub)
+			continue
+		}
+
+		parts := splitText(sub.Text, (duration+maxDurationMs-1)/maxDurationMs)
+		total := 0
+		for _, part := range parts {
+			total += CountReadingChars(part)
+		}
+
+		done := 0
+		for i, part := range parts {
+			piece := sub
+			piece.Text = part
+			piece.StartMs = sub.StartMs + duration*done/total
+			done += CountReadingChars(part)
+			if i < len(parts)-1 {
+				piece.EndMs = sub.StartMs + duration*done/total
+			}
+			result = append(result, piece)
+		}
+	}
+
+	return result
+}
+
+// splitText divides text into at most n parts of about equal length, cutting only
+// where WrapLines could break a line. Lines of multi-line text are joined first.
+func splitText(text string, n int) []string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+
+	// Character count before each break opportunity
+	var cuts, charsAt []int
+	chars := 0
+	for i, r := range runes {
+		if i > 0 && canBreakBefore(runes, i) {
+			cuts = append(cuts, i)
+			charsAt = append(charsAt, chars)
+		}
+		if !unicode.Is(unicode.Mn, r) {
+			chars++
+		}
+	}
+
+	// Cut at the opportunity closest to each equal share of the text
+	var parts []string
+	start, next := 0, 0
+	for k := 1; k < n; k++ {
+		target := chars * k / n
+		best := -1
+		for j := next; j < len(cuts); j++ {
+			if best < 0 || abs(charsAt[j]-target) < abs(charsAt[best]-target) {
+				best = j
+			}
+		}
+		if best < 0 {
+			break
+		}
+		if part := strings.TrimSpace(string(runes[start:cuts[best]])); part != "" {
+			parts = append(parts, part)
+			start = cuts[best]
+		}
+		next = best + 1
+	}
+	if part := strings.TrimSpace(string(runes[start:])); part != "" || len(parts) == 0 {
+		parts = append(parts, part)
+	}
+
+	return parts
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,217 @@
+package subtitle
+
+import (
+	"reflect"
+	"testing"
+
+	"yt_enhancer/pkg/models"
+)
+
+func TestNormalizeTimelineMinDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		subs []models.Subtitle
+		want []models.Subtitle
+	}{
+		{
+			name: "back-to-back overlaps are trimmed",
+			subs: []models.Subtitle{
+				{StartMs: 0, EndMs: 2000, Text: "a"},
+				{StartMs: 1000, EndMs: 3000, Text: "b"},
+				{StartMs: 2000, EndMs: 4000, Text: "c"},
+			},
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 900, Text: "a"},
+				{StartMs: 1000, EndMs: 1900, Text: "b"},
+				{StartMs: 2000, EndMs: 4000, Text: "c"},
+			},
+		},
+		{
+			name: "next block starts later to keep the minimum",
+			subs: []models.Subtitle{
+				{StartMs: 0, EndMs: 2000, Text: "a"},
+				{StartMs: 200, EndMs: 2000, Text: "b"},
+			},
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 300, Text: "a"},
+				{StartMs: 400, EndMs: 2000, Text: "b"},
+			},
+		},
+		{
+			name: "blocks that can't spare time are merged",
+			subs: []models.Subtitle{
+				{StartMs: 0, EndMs: 2000, Text: "a"},
+				{StartMs: 200, EndMs: 500, Text: "b"},
+			},
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 2000, Text: "a b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeTimeline(tt.subs, 100)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeTimeline =\n%+v\nwant\n%+v", got, tt.want)
+			}
+			for i, sub := range got {
+				if sub.EndMs-sub.StartMs < minCueDurationMs {
+					t.Errorf("block %d lasts %dms, less than %dms", i, sub.EndMs-sub.StartMs, minCueDurationMs)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeTimeline(t *testing.T) {
+	tests := []struct {
+		name string
+		subs []models.Subtitle
+		want []models.Subtitle
+	}{
+		{
+			name: "empty",
+			subs: nil,
+			want: nil,
+		},
+		{
+			name: "single block",
+			subs: []models.Subtitle{{StartMs: 500, EndMs: 900, Text: "a"}},
+			want: []models.Subtitle{{StartMs: 500, EndMs: 900, Text: "a"}},
+		},
+		{
+			name: "cascading overlaps",
+			subs: []models.Subtitle{
+				{StartMs: 0, EndMs: 5000, Text: "a"},
+				{StartMs: 1000, EndMs: 5000, Text: "b"},
+				{StartMs: 2000, EndMs: 5000, Text: "c"},
+				{StartMs: 3000, EndMs: 6000, Text: "d"},
+			},
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 900, Text: "a"},
+				{StartMs: 1000, EndMs: 1900, Text: "b"},
+				{StartMs: 2000, EndMs: 2900, Text: "c"},
+				{StartMs: 3000, EndMs: 6000, Text: "d"},
+			},
+		},
+		{
+			name: "block overrunning the one after next",
+			subs: []models.Subtitle{
+				{StartMs: 0, EndMs: 5000, Text: "a"},
+				{StartMs: 1000, EndMs: 1500, Text: "b"},
+				{StartMs: 2000, EndMs: 3000, Text: "c"},
+			},
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 900, Text: "a"},
+				{StartMs: 1000, EndMs: 1500, Text: "b"},
+				{StartMs: 2000, EndMs: 3000, Text: "c"},
+			},
+		},
+		{
+			name: "out of order",
+			subs: []models.Subtitle{
+				{StartMs: 2000, EndMs: 3000, Text: "b"},
+				{StartMs: 0, EndMs: 2500, Text: "a"},
+			},
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 1900, Text: "a"},
+				{StartMs: 2000, EndMs: 3000, Text: "b"},
+			},
+		},
+		{
+			name: "merged blocks keep both word ranges",
+			subs: []models.Subtitle{
+				{StartMs: 0, EndMs: 2000, Text: "a", FirstWord: 0, WordCount: 3},
+				{StartMs: 200, EndMs: 500, Text: "b", FirstWord: 3, WordCount: 2},
+			},
+			want: []models.Subtitle{
+				{StartMs: 0, EndMs: 2000, Text: "a b", FirstWord: 0, WordCount: 5},
+			},
+		},
+		{
+			name: "equal start times",
+			subs: []models.Subtitle{
+				{StartMs: 1000, EndMs: 2000, Text: "a"},
+				{StartMs: 1000, EndMs: 3000, Text: "b"},
+			},
+			want: []models.Subtitle{
+				{StartMs: 1000, EndMs: 1300, Text: "a"},
+				{StartMs: 1400, EndMs: 3000, Text: "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeTimeline(tt.subs, 100)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeTimeline =\n%+v\nwant\n%+v", got, tt.want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i-1].EndMs > got[i].StartMs-100 {
+					t.Errorf("block %d ends at %dms, within 100ms of block %d starting at %dms",
+						i-1, got[i-1].EndMs, i, got[i].StartMs)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeSentencePunctuation(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []string
+		want  []string
+	}{
+		{
+			name:  "sentence-final cues get a period",
+			texts: []string{"Hello there ", "How are you"},
+			want:  []string{"Hello there.", "How are you."},
+		},
+		{
+			name:  "existing terminal punctuation is kept",
+			texts: []string{"Really?", "Yes!", `He said "stop"`, "Then…"},
+			want:  []string{"Really?", "Yes!", `He said "stop".`, "Then…"},
+		},
+		{
+			name:  "sentence-internal cues lose a stray period",
+			texts: []string{"I went to the.", "store today."},
+			want:  []string{"I went to the", "store today."},
+		},
+		{
+			name:  "abbreviations and ellipses keep their periods",
+			texts: []string{"I met Mr.", "and Mrs. Smith in the U.S.", "while on tour...", "and then left."},
+			want:  []string{"I met Mr.", "and Mrs. Smith in the U.S.", "while on tour...", "and then left."},
+		},
+		{
+			name:  "next cue starting with a digit",
+			texts: []string{"It costs", "5 dollars"},
+			want:  []string{"It costs", "5 dollars."},
+		},
+		{
+			name:  "caseless scripts are left alone",
+			texts: []string{"สวัสดีครับ", "วันนี้อากาศดี"},
+			want:  []string{"สวัสดีครับ", "วันนี้อากาศดี"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs := make([]models.Subtitle, len(tt.texts))
+			for i, text := range tt.texts {
+				subs[i] = models.Subtitle{StartMs: i * 1000, EndMs: i*1000 + 900, Text: text}
+			}
+			var got []string
+			for _, sub := range NormalizeSentencePunctuation(subs) {
+				got = append(got, sub.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeSentencePunctuation = %q, want %q", got, tt.want)
+			}
+			if subs[0].Text != tt.texts[0] {
+				t.Errorf("input was modified: %q", subs[0].Text)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package subtitle
+
+import (
+	"strings"
+	"unicode"
+
+	"yt_enhancer/pkg/models"
+)
+
+// thaiCharsPerWord is the approximate number of Thai base characters (excluding
+// vowel and tone marks) in an average Thai word, used to estimate word counts
+// since Thai doesn't separate words with spaces
+const thaiCharsPerWord = 4
+
+// CountWords estimates the number of words in text. Space-separated tokens count
+// as one word each, except tokens in Thai script, which are estimated from their
+// character count.
+func CountWords(text string) int {
+	count := 0
+	for _, token := range strings.Fields(text) {
+		thaiChars := 0
+		for _, r := range token {
+			if unicode.Is(unicode.Thai, r) && !unicode.Is(unicode.Mn, r) {
+				thaiChars++
+			}
+		}
+
+		if thaiChars == 0 {
+			count++
+			continue
+		}
+
+		words := (thaiChars + thaiCharsPerWord - 1) / thaiCharsPerWord
+		count += words
+	}
+	return count
+}
+
+// FlagImplausibleTiming returns the indices of subtitles whose words-per-second
+// rate exceeds maxWPS, which usually means the block was mis-timed rather than
+// merely hard to read. Blocks with no duration are always flagged when non-empty.
+func FlagImplausibleTiming(subs []models.Subtitle, maxWPS float64) []int {
+	var flagged []int
+	if maxWPS <= 0 {
+		return flagged
+	}
+
+	for i, sub := range subs {
+		words := CountWords(sub.Text)
+		if words == 0 {
+			continue
+		}
+
+		durationSec := float64(sub.EndMs-sub.StartMs) / 1000
+		if durationSec <= 0 || float64(words)/durationSec > maxWPS {
+			flagged = append(flagged, i)
+		}
+	}
+	return flagged
+}
+
+// CountReadingChars counts the characters a viewer has to read in text. Combining
+// marks, such as Thai vowel and tone marks, don't count as separate characters.
+func CountReadingChars(text string) int {
+	count := 0
+	for _, r := range text {
+		if !unicode.Is(unicode.Mn, r) {
+			count++
+		}
+	}
+	return count
+}
+
+// EnforceReadingSpeed extends subtitles whose characters-per-second rate exceeds
+// the limit, up to gapMs before the next subtitle's start, so no overlaps are
+// introduced. Blocks containing Thai script use maxCPSThai; all others use maxCPS.
+// A limit of zero or less disables the pass for that script.
+func EnforceReadingSpeed(subs []models.Subtitle, maxCPS, maxCPSThai float64, gapMs int) []models.Subtitle {
+	result := make([]models.Subtitle, len(subs))
+	copy(result, subs)
+
+	for i := range result {
+		limit := maxCPS
+		if isThai(result[i].Text) {
+			limit = maxCPSThai
+		}
+		if limit <= 0 {
+			continue
+		}
+
+		chars := CountReadingChars(strings.TrimSpace(result[i].Text))
+		required := result[i].StartMs + int(float64(chars)/limit*1000+0.5)
+		if required <= result[i].EndMs {
+			continue
+		}
+
+		// Never run into the next block
+		if i+1 < len(result) && required > result[i+1].StartMs-gapMs {
+			required = result[i+1].StartMs - gapMs
+		}
+		if required > result[i].EndMs {
+			result[i].EndMs = required
+		}
+	}
+
+	return result
+}
+
+// isThai reports whether text contains Thai script
+func isThai(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.Thai, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package subtitle
+
+import (
+	"strings"
+	"unicode"
+
+	"yt_enhancer/pkg/models"
+)
+
+// thaiLeadingVowels are written before the consonant they follow in speech, so a
+// Thai syllable (and usually a word) can start with one of them
+const thaiLeadingVowels = "เแโใไ"
+
+// WrapLines breaks each subtitle's text into lines of at most maxLineLength
+// characters, using no more than maxLines lines. Lines are broken at spaces and, in
+// Thai text, before leading vowels and after the repetition mark (ๆ) and paiyannoi
+// (ฯ); a line is only broken mid-word when it has no such opportunity. Text that
+// doesn't fit in maxLines lines is kept on the last line rather than dropped.
+// Text that already has several lines, such as bilingual cues, is wrapped line by
+// line. Blocks already under the limit pass through untouched, and a maxLineLength
+// of zero or less disables wrapping.
+func WrapLines(subs []models.Subtitle, maxLineLength, maxLines int) []models.Subtitle {
+	result := make([]models.Subtitle, len(subs))
+	copy(result, subs)
+	if maxLineLength <= 0 {
+		return result
+	}
+	if maxLines < 1 {
+		maxLines = 1
+	}
+
+	for i := range result {
+		if fitsLines(result[i].Text, maxLineLength) {
+			continue
+		}
+		lines := strings.Split(result[i].Text, "\n")
+		for j, line := range lines {
+			lines[j] = wrapText(line, maxLineLength, maxLines)
+		}
+		result[i].Text = strings.Join(lines, "\n")
+	}
+
+	return result
+}
+
+// fitsLines reports whether every line of text is within maxLineLength characters
+func fitsLines(text string, maxLineLength int) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if CountReadingChars(line) > maxLineLength {
+			return false
+		}
+	}
+	return true
+}
+
+// wrapText greedily fills lines up to maxLineLength characters
+func wrapText(text string, maxLineLength, maxLines int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	var lines []string
+
+	for len(runes) > 0 {
+		if len(lines) == maxLines-1 || CountReadingChars(string(runes)) <= maxLineLength {
+			lines = append(lines, string(runes))
+			break
+		}
+
+		cut := lineBreak(runes, maxLineLength)
+		lines = append(lines, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// lineBreak returns the rune index at which to end a line starting at runes[0]:
+// the last break opportunity within maxLineLength characters, or the last
+// character boundary that fits when there is none
+func lineBreak(runes []rune, maxLineLength int) int {
+	chars := 0
+	fit := 0
+	lastBreak := 0
+
+	for i, r := range runes {
+		if !unicode.Is(unicode.Mn, r) {
+			if chars == maxLineLength {
+				break
+			}
+			chars++
+		}
+		fit = i + 1
+
+		// A combining mark belongs to the preceding character
+		if i+1 < len(runes) && unicode.Is(unicode.Mn, runes[i+1]) {
+			continue
+		}
+		if i > 0 && canBreakBefore(runes, i+1) {
+			lastBreak = i + 1
+		}
+	}
+
+	if lastBreak > 0 {
+		return lastBreak
+	}
+	if fit == 0 {
+		return 1
+	}
+	return fit
+}
+
+// canBreakBefore reports whether a line may break between runes[i-1] and runes[i]
+func canBreakBefore(runes []rune, i int) bool {
+	if i >= len(runes) {
+		return false
+	}
+	prev, next := runes[i-1], runes[i]
+	switch {
+	case next == ' ' || prev == ' ':
+		return true
+	case prev == 'ๆ' || prev == 'ฯ':
+		return true
+	case strings.ContainsRune(thaiLeadingVowels, next) && unicode.Is(unicode.Thai, prev):
+		return true
+	}
+	return false
+}
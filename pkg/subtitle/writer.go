@@ -3,15 +3,146 @@ package subtitle
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"yt_enhancer/pkg/models"
 )
 
+// Formats lists the output formats supported by WriteFormat
+var Formats = []string{"srt", "vtt", "json", "ass", "json3", "txt"}
+
+// WriteFormat writes subtitles to outputPath serialized in the given format,
+// regardless of the path's extension
+func WriteFormat(subtitles []models.Subtitle, outputPath, format string) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	return writeFile(outputPath, func(w io.Writer) error {
+		return WriteFormatTo(w, subtitles, format)
+	})
+}
+
+// WriteFormats writes subtitles once in each of formats, to basePath with the
+// format as its extension, e.g. video.srt and video.json for the base path video.
+// All formats are checked before any file is written. It returns the paths written.
+func WriteFormats(subtitles []models.Subtitle, basePath string, formats []string) ([]string, error) {
+	for _, format := range formats {
+		if err := checkFormat(format); err != nil {
+			return nil, err
+		}
+	}
+
+	var paths []string
+	for _, format := range formats {
+		path := basePath + "." + strings.ToLower(format)
+		if err := WriteFormat(subtitles, path, format); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// WriteSubtitles writes subtitles to outputPath in the format its extension names:
+// .srt, .vtt, .json, .ass, .json3 or .txt. Unknown extensions are an error; use
+// WriteFormat to write a format under another extension.
+func WriteSubtitles(subtitles []models.Subtitle, outputPath string) error {
+	format := FormatFromPath(outputPath)
+	if format == "" {
+		return fmt.Errorf("unsupported output extension %q (supported: .%s)", filepath.Ext(outputPath), strings.Join(Formats, ", ."))
+	}
+	return WriteFormat(subtitles, outputPath, format)
+}
+
+// WriteFormatTo writes subtitles to w serialized in the given format
+func WriteFormatTo(w io.Writer, subtitles []models.Subtitle, format string) error {
+	switch strings.ToLower(format) {
+	case "srt":
+		return WriteSRTTo(w, subtitles)
+	case "vtt":
+		return WriteVTTTo(w, subtitles)
+	case "json":
+		return WriteJSONTo(w, subtitles)
+	case "ass":
+		return WriteASSTo(w, subtitles)
+	case "json3":
+		return WriteJSON3To(w, subtitles)
+	case "txt":
+		return WriteTextTo(w, subtitles)
+	default:
+		return checkFormat(format)
+	}
+}
+
+// checkFormat returns an error if format isn't one of Formats
+func checkFormat(format string) error {
+	for _, f := range Formats {
+		if strings.ToLower(format) == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format %q (supported: %s)", format, strings.Join(Formats, ", "))
+}
+
+// writeFile creates outputPath and passes it to write
+func writeFile(outputPath string, write func(w io.Writer) error) error {
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// FormatFromPath returns the output format matching the extension of path, or an
+// empty string if the extension isn't a supported format
+func FormatFromPath(path string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	for _, format := range Formats {
+		if ext == format {
+			return format
+		}
+	}
+	return ""
+}
+
+// TranslatedPath returns the path of the translation of the subtitle file at path,
+// inserting the language code before the extension (name.srt becomes name.en.srt).
+// The stdout path "-" is returned unchanged.
+func TranslatedPath(path, lang string) string {
+	if path == "-" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + lang + ext
+}
+
 // WriteSRT writes subtitles to an SRT file
 func WriteSRT(subtitles []models.Subtitle, outputPath string) error {
+	return WriteSRTNumbered(subtitles, outputPath, 1)
+}
+
+// WriteSRTTo writes subtitles in SRT format to w
+func WriteSRTTo(w io.Writer, subtitles []models.Subtitle) error {
+	return WriteSRTNumberedTo(w, subtitles, 1)
+}
+
+// WriteSRTNumbered writes subtitles to an SRT file, numbering cues from firstNumber
+func WriteSRTNumbered(subtitles []models.Subtitle, outputPath string, firstNumber int) error {
+	return writeFile(outputPath, func(w io.Writer) error {
+		return WriteSRTNumberedTo(w, subtitles, firstNumber)
+	})
+}
+
+// WriteSRTNumberedTo writes subtitles in SRT format to w, numbering cues from firstNumber
+func WriteSRTNumberedTo(w io.Writer, subtitles []models.Subtitle, firstNumber int) error {
 	var srtBuilder strings.Builder
 
 	for i, subtitle := range subtitles {
@@ -20,31 +151,102 @@ func WriteSRT(subtitles []models.Subtitle, outputPath string) error {
 		endTime := millisecondsToSRTTimestamp(subtitle.EndMs)
 
 		// Write SRT entry
-		srtBuilder.WriteString(fmt.Sprintf("%d\n", i+1))
+		srtBuilder.WriteString(fmt.Sprintf("%d\n", firstNumber+i))
 		srtBuilder.WriteString(fmt.Sprintf("%s --> %s\n", startTime, endTime))
-		srtBuilder.WriteString(fmt.Sprintf("%s\n\n", subtitle.Text))
+		srtBuilder.WriteString(fmt.Sprintf("%s\n\n", cueText(subtitle.Text)))
+	}
+
+	_, err := io.WriteString(w, srtBuilder.String())
+	return err
+}
+
+// WriteVTT writes subtitles to a WebVTT file
+func WriteVTT(subtitles []models.Subtitle, outputPath string) error {
+	return writeFile(outputPath, func(w io.Writer) error {
+		return WriteVTTTo(w, subtitles)
+	})
+}
+
+// WriteVTTTo writes subtitles in WebVTT format to w
+func WriteVTTTo(w io.Writer, subtitles []models.Subtitle) error {
+	var vttBuilder strings.Builder
+
+	vttBuilder.WriteString("WEBVTT\n\n")
+
+	for _, subtitle := range subtitles {
+		// Cues must have a positive duration to be valid
+		endMs := subtitle.EndMs
+		if endMs <= subtitle.StartMs {
+			endMs = subtitle.StartMs + 1
+		}
+
+		// Convert milliseconds to VTT timestamp format
+		startTime := millisecondsToVTTTimestamp(subtitle.StartMs)
+		endTime := millisecondsToVTTTimestamp(endMs)
+
+		// Write VTT cue
+		vttBuilder.WriteString(fmt.Sprintf("%s --> %s\n", startTime, endTime))
+		vttBuilder.WriteString(fmt.Sprintf("%s\n\n", escapeVTTText(cueText(subtitle.Text))))
+	}
+
+	_, err := io.WriteString(w, vttBuilder.String())
+	return err
+}
+
+// cueText prepares multi-line cue text for SRT and VTT, where a blank line ends the
+// cue. Line breaks are kept, while blank lines and carriage returns are removed.
+func cueText(text string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
 	}
+	return strings.Join(lines, "\n")
+}
 
-	return os.WriteFile(outputPath, []byte(srtBuilder.String()), 0644)
+// escapeVTTText escapes characters that have special meaning in WebVTT cue text
+func escapeVTTText(text string) string {
+	text = strings.ReplaceAll(text, "&", "&amp;")
+	text = strings.ReplaceAll(text, "<", "&lt;")
+	return strings.ReplaceAll(text, "-->", "--&gt;")
 }
 
 // WriteJSON writes subtitles to a JSON file
 func WriteJSON(subtitles []models.Subtitle, outputPath string) error {
+	return writeFile(outputPath, func(w io.Writer) error {
+		return WriteJSONTo(w, subtitles)
+	})
+}
+
+// WriteJSONTo writes subtitles as JSON to w
+func WriteJSONTo(w io.Writer, subtitles []models.Subtitle) error {
 	data, err := json.MarshalIndent(subtitles, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling JSON: %w", err)
 	}
 
-	return os.WriteFile(outputPath, data, 0644)
+	_, err = w.Write(data)
+	return err
 }
 
 // Helper function to convert milliseconds to SRT timestamp format (HH:MM:SS,MMM)
 func millisecondsToSRTTimestamp(ms int) string {
+	return millisecondsToTimestamp(ms, ",")
+}
+
+// Helper function to convert milliseconds to VTT timestamp format (HH:MM:SS.MMM)
+func millisecondsToVTTTimestamp(ms int) string {
+	return millisecondsToTimestamp(ms, ".")
+}
+
+// Helper function to convert milliseconds to HH:MM:SS<sep>MMM
+func millisecondsToTimestamp(ms int, sep string) string {
 	duration := time.Duration(ms) * time.Millisecond
 	hours := int(duration.Hours())
 	minutes := int(duration.Minutes()) % 60
 	seconds := int(duration.Seconds()) % 60
 	milliseconds := ms % 1000
 
-	return fmt.Sprintf("%02d:%02d:%02d,%03d", hours, minutes, seconds, milliseconds)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", hours, minutes, seconds, sep, milliseconds)
 }